@@ -0,0 +1,91 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+
+	runtime "github.com/njasm/clerk/internal/runtime"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+// inspect prints how clerk sees the given containers, or every running container, and
+// the problems found in their labels, without registering anything.
+func inspect(out io.Writer, containerIDs []string) error {
+	rt, err := runtime.New(utils.EnvOrDefault("CLERK_RUNTIME", "docker"))
+	if err != nil {
+		return err
+	}
+
+	policy, err := service.NewPolicy()
+	if err != nil {
+		return err
+	}
+
+	advertiser, err := service.NewAdvertiser()
+	if err != nil {
+		return err
+	}
+
+	service.SetAdvertiser(advertiser)
+	if advertised, err := advertiser.Addresses(); err == nil {
+		fmt.Fprintf(out, "advertise address: %s (%s)\n", advertised.Address(), advertised.Source)
+	}
+
+	ctx := context.Background()
+	if len(containerIDs) == 0 {
+		if containerIDs, err = rt.List(ctx); err != nil {
+			return err
+		}
+	}
+
+	for _, containerID := range containerIDs {
+		container, err := rt.Inspect(ctx, containerID)
+		if err != nil {
+			return err
+		}
+
+		printService(out, service.NewFrom(container), policy)
+	}
+
+	return nil
+}
+
+func printService(out io.Writer, srv *service.Service, policy *service.Policy) {
+	fmt.Fprintf(out, "container %s\n", srv.ContainerID())
+	fmt.Fprintf(out, "  name: %s\n", srv.Name())
+	fmt.Fprintf(out, "  register: %t\n", policy.Register(srv))
+
+	instances := srv.Instances()
+	ids := make([]string, 0, len(instances))
+	for id := range instances {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	for _, id := range ids {
+		instance := instances[id]
+		fmt.Fprintf(out, "  instance: %s %s:%d/%s\n", id, instance.IP, instance.Port, instance.Proto)
+	}
+
+	config := srv.Config()
+	keys := make([]string, 0, len(config))
+	for key := range config {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(out, "  config: %s=%s\n", key, config[key])
+	}
+
+	for _, err := range srv.Errors() {
+		fmt.Fprintf(out, "  error: %v\n", err)
+	}
+
+	for _, diagnostic := range srv.Diagnostics() {
+		fmt.Fprintf(out, "  %s\n", diagnostic)
+	}
+}
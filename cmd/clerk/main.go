@@ -8,9 +8,16 @@ import (
 
 	clerk "github.com/njasm/clerk/internal"
 	registry "github.com/njasm/clerk/internal/registry"
+	runtime "github.com/njasm/clerk/internal/runtime"
+	"github.com/njasm/clerk/internal/utils"
 )
 
 func main() {
+	if len(os.Args) > 1 && os.Args[1] == "inspect" {
+		ExitOnError(inspect(os.Stdout, os.Args[2:]))
+		return
+	}
+
 	fmt.Println("Starting Clerk")
 
 	stop := make(chan bool, 1)
@@ -23,10 +30,13 @@ func main() {
 		stopServer <- true
 	}(stop, osSignal)
 
-	r, err := registry.NewConsul()
+	r, err := registry.New(utils.EnvOrDefault("CLERK_REGISTRY", "consul"))
+	ExitOnError(err)
+
+	rt, err := runtime.New(utils.EnvOrDefault("CLERK_RUNTIME", "docker"))
 	ExitOnError(err)
 
-	server, err := clerk.New(stop, r)
+	server, err := clerk.New(stop, r, rt)
 	ExitOnError(err)
 
 	server.Start()
@@ -6,3 +6,20 @@ const CONFIG_SERVICE_NAME = CONFIG_PREFIX + "name"
 const CONFIG_SERVICE_PORTS = CONFIG_PREFIX + "ports"
 const CONFIG_SERVICE_TAGS = CONFIG_PREFIX + "tags"
 const CONFIG_SERVICE_ATTRIBUTES = CONFIG_PREFIX + "attributes"
+const CONFIG_CONSUL_KV_PREFIX = CONFIG_PREFIX + "kv."
+const CONFIG_SWARM_PUBLISH = CONFIG_PREFIX + "swarm.publish"
+
+// labels set by Docker on the containers of Swarm tasks
+const SWARM_SERVICE_ID = "com.docker.swarm.service.id"
+const SWARM_SERVICE_NAME = "com.docker.swarm.service.name"
+const SWARM_TASK_ID = "com.docker.swarm.task.id"
+const CONFIG_NAMING_STRATEGY = CONFIG_PREFIX + "naming"
+
+// labels set by Docker Compose on the containers of a project
+const COMPOSE_PROJECT = "com.docker.compose.project"
+const COMPOSE_SERVICE = "com.docker.compose.service"
+const COMPOSE_CONTAINER_NUMBER = "com.docker.compose.container-number"
+const CONFIG_INSTANCE_ID = CONFIG_PREFIX + "id"
+const CONFIG_ADDRESS_FAMILY = CONFIG_PREFIX + "address.family"
+const CONFIG_ADVERTISE_ADDRESS = CONFIG_PREFIX + "advertise.address"
+const CONFIG_PROTOCOL_NAMING = CONFIG_PREFIX + "proto.naming"
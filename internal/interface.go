@@ -1,13 +1,30 @@
 package clerk
 
 import (
-	docker "github.com/docker/docker/client"
+	"context"
+
 	"github.com/njasm/clerk/internal/service"
 )
 
-// DockerAPIClient is an interface that clients that talk with a docker server must implement.
-type DockerAPIClient interface {
-	docker.APIClient
+const (
+	EVENT_START = "start"
+	EVENT_DIE   = "die"
+)
+
+// ContainerEvent is a container lifecycle event, reported by a Runtime.
+type ContainerEvent struct {
+	ContainerID string
+	Action      string
+}
+
+// Runtime is the container runtime clerk watches: Docker, Podman or containerd.
+type Runtime interface {
+	ID() string
+	// List returns the IDs of the running containers.
+	List(ctx context.Context) ([]string, error)
+	Inspect(ctx context.Context, containerID string) (service.Container, error)
+	// Events streams the container start and die events until ctx is done.
+	Events(ctx context.Context) (<-chan ContainerEvent, <-chan error)
 }
 
 type Registry interface {
@@ -17,3 +34,15 @@ type Registry interface {
 	Unregister(service *service.Service) error
 	Services() ([]*service.RegisteredService, error)
 }
+
+// Collector is a Registry that removes what a previous run of clerk left behind, once the
+// running containers are registered.
+type Collector interface {
+	Collect() error
+}
+
+// MultiRegistry is a Registry that forwards to several backends, each one is reconciled on its own.
+type MultiRegistry interface {
+	Registry
+	Registries() []Registry
+}
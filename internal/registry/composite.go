@@ -0,0 +1,215 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const compositeID = "composite"
+
+const (
+	envRegistryRetries      = "CLERK_REGISTRY_RETRIES"
+	envRegistryRetryBackoff = "CLERK_REGISTRY_RETRY_BACKOFF"
+	envRegistryRetryMaxWait = "CLERK_REGISTRY_RETRY_MAX_WAIT"
+
+	defaultRegistryRetries      = "3"
+	defaultRegistryRetryBackoff = "500ms"
+	defaultRegistryRetryMaxWait = "2s"
+)
+
+// CompositeError holds the error of every backend that failed, keyed by backend ID.
+type CompositeError map[string]error
+
+func (e CompositeError) Error() string {
+	messages := []string{}
+	for _, id := range e.ids() {
+		messages = append(messages, fmt.Sprintf("%s: %s", id, e[id]))
+	}
+
+	return strings.Join(messages, "; ")
+}
+
+func (e CompositeError) Unwrap() []error {
+	rv := []error{}
+	for _, err := range e {
+		rv = append(rv, err)
+	}
+
+	return rv
+}
+
+// Is reports whether the error of a backend is target, errors.Is only unwraps a
+// []error from go 1.20 on.
+func (e CompositeError) Is(target error) bool {
+	for _, id := range e.ids() {
+		if errors.Is(e[id], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// As finds the first error of a backend, by backend ID, that matches target.
+func (e CompositeError) As(target interface{}) bool {
+	for _, id := range e.ids() {
+		if errors.As(e[id], target) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (e CompositeError) ids() []string {
+	ids := make([]string, 0, len(e))
+	for id := range e {
+		ids = append(ids, id)
+	}
+
+	sort.Strings(ids)
+	return ids
+}
+
+func NewComposite(backends ...clerk.Registry) (*Composite, error) {
+	retries, err := strconv.Atoi(utils.EnvOrDefault(envRegistryRetries, defaultRegistryRetries))
+	if err != nil {
+		return nil, fmt.Errorf("error creating composite registry: %w", err)
+	}
+
+	backoff, err := time.ParseDuration(utils.EnvOrDefault(envRegistryRetryBackoff, defaultRegistryRetryBackoff))
+	if err != nil {
+		return nil, fmt.Errorf("error creating composite registry: %w", err)
+	}
+
+	maxWait, err := time.ParseDuration(utils.EnvOrDefault(envRegistryRetryMaxWait, defaultRegistryRetryMaxWait))
+	if err != nil {
+		return nil, fmt.Errorf("error creating composite registry: %w", err)
+	}
+
+	return &Composite{backends: backends, retries: retries, backoff: backoff, maxWait: maxWait}, nil
+}
+
+// Composite forwards every operation to all its backends at the same time. A failing
+// backend is retried with exponential backoff and never blocks the others. Operations run
+// on the event loop, so the retries of an operation wait maxWait at most in total.
+type Composite struct {
+	backends []clerk.Registry
+	retries  int
+	backoff  time.Duration
+	maxWait  time.Duration
+}
+
+func (c *Composite) ID() string {
+	return compositeID
+}
+
+// Registries returns the backends, so the server can reconcile each one on its own.
+func (c *Composite) Registries() []clerk.Registry {
+	return c.backends
+}
+
+func (c *Composite) Ping() error {
+	return c.each(func(r clerk.Registry) error { return r.Ping() })
+}
+
+func (c *Composite) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	return c.each(func(r clerk.Registry) error { return c.retry(r, "register", service, r.Register) })
+}
+
+func (c *Composite) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	return c.each(func(r clerk.Registry) error { return c.retry(r, "unregister", service, r.Unregister) })
+}
+
+// Services returns the services of every backend that answered, without duplicates.
+func (c *Composite) Services() ([]*service.RegisteredService, error) {
+	var mu sync.Mutex
+	seen := map[string]bool{}
+	rv := []*service.RegisteredService{}
+
+	err := c.each(func(r clerk.Registry) error {
+		services, err := r.Services()
+		if err != nil {
+			return err
+		}
+
+		mu.Lock()
+		defer mu.Unlock()
+
+		for _, s := range services {
+			if !seen[s.ID] {
+				seen[s.ID] = true
+				rv = append(rv, s)
+			}
+		}
+
+		return nil
+	})
+
+	return rv, err
+}
+
+// each runs fn against every backend concurrently and collects their errors.
+func (c *Composite) each(fn func(r clerk.Registry) error) error {
+	var mu sync.Mutex
+	var group sync.WaitGroup
+	errs := CompositeError{}
+
+	for _, backend := range c.backends {
+		group.Add(1)
+		go func(r clerk.Registry) {
+			defer group.Done()
+
+			if err := fn(r); err != nil {
+				mu.Lock()
+				errs[r.ID()] = err
+				mu.Unlock()
+			}
+		}(backend)
+	}
+
+	group.Wait()
+	if len(errs) == 0 {
+		return nil
+	}
+
+	return errs
+}
+
+func (c *Composite) retry(r clerk.Registry, op string, srv *service.Service, fn func(*service.Service) error) error {
+	backoff, waited := c.backoff, time.Duration(0)
+	err := fn(srv)
+	for attempt := 1; err != nil && attempt <= c.retries; attempt++ {
+		if waited+backoff > c.maxWait {
+			log.Println(fmt.Errorf("%s: %s %s failed, giving up after %s of retries: %w", r.ID(), op, srv.ID(), waited, err))
+			break
+		}
+
+		log.Println(fmt.Errorf("%s: %s %s failed, retry %d/%d in %s: %w", r.ID(), op, srv.ID(), attempt, c.retries, backoff, err))
+		time.Sleep(backoff)
+		waited += backoff
+		backoff *= 2
+
+		err = fn(srv)
+	}
+
+	return err
+}
@@ -0,0 +1,161 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"sync"
+	"testing"
+	"time"
+
+	clerk "github.com/njasm/clerk/internal"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+var errBackendDown = errors.New("backend down")
+
+// fakeRegistry fails its first `failures` calls.
+type fakeRegistry struct {
+	id       string
+	failures int
+
+	mu       sync.Mutex
+	calls    int
+	services map[string]*service.RegisteredService
+}
+
+func newFakeRegistry(id string, failures int) *fakeRegistry {
+	return &fakeRegistry{id: id, failures: failures, services: map[string]*service.RegisteredService{}}
+}
+
+func (f *fakeRegistry) fail() bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.calls++
+	return f.calls <= f.failures
+}
+
+func (f *fakeRegistry) ID() string { return f.id }
+
+func (f *fakeRegistry) Ping() error {
+	if f.fail() {
+		return errBackendDown
+	}
+
+	return nil
+}
+
+func (f *fakeRegistry) Register(srv *service.Service) error {
+	if f.fail() {
+		return errBackendDown
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, instance := range srv.Instances() {
+		f.services[instance.ID] = registeredInstance(srv, instance)
+	}
+
+	return nil
+}
+
+func (f *fakeRegistry) Unregister(srv *service.Service) error {
+	if f.fail() {
+		return errBackendDown
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, instance := range srv.Instances() {
+		delete(f.services, instance.ID)
+	}
+
+	return nil
+}
+
+func (f *fakeRegistry) Services() ([]*service.RegisteredService, error) {
+	if f.fail() {
+		return nil, errBackendDown
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	rv := []*service.RegisteredService{}
+	for _, s := range f.services {
+		rv = append(rv, s)
+	}
+
+	return rv, nil
+}
+
+func TestCompositeRetries(t *testing.T) {
+	flaky := newFakeRegistry("flaky", 2)
+	healthy := newFakeRegistry("healthy", 0)
+	c := &Composite{backends: []clerk.Registry{flaky, healthy}, retries: 3, backoff: time.Millisecond, maxWait: time.Second}
+
+	assert.NoError(t, c.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+	assert.Len(t, flaky.services, 1)
+	assert.Len(t, healthy.services, 1)
+	assert.Equal(t, 3, flaky.calls)
+
+	services, err := c.Services()
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+}
+
+func TestCompositeIsolatesFailingBackend(t *testing.T) {
+	broken := newFakeRegistry("broken", 100)
+	healthy := newFakeRegistry("healthy", 0)
+	c := &Composite{backends: []clerk.Registry{broken, healthy}, retries: 1, backoff: time.Millisecond, maxWait: time.Second}
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+
+	err := c.Register(srv)
+	var compositeErr CompositeError
+	assert.ErrorAs(t, err, &compositeErr)
+	assert.Len(t, compositeErr, 1)
+	assert.ErrorIs(t, compositeErr["broken"], errBackendDown)
+	assert.True(t, compositeErr.Is(errBackendDown))
+	assert.ErrorIs(t, err, errBackendDown)
+	assert.Len(t, healthy.services, 1)
+
+	services, err := c.Services()
+	assert.Error(t, err)
+	assert.Len(t, services, 1)
+
+	assert.Error(t, c.Unregister(srv))
+	assert.Empty(t, healthy.services)
+}
+
+func TestCompositeRetriesMaxWait(t *testing.T) {
+	broken := newFakeRegistry("broken", 100)
+	c := &Composite{backends: []clerk.Registry{broken}, retries: 10, backoff: 10 * time.Millisecond, maxWait: 35 * time.Millisecond}
+
+	// waits 10ms and 20ms, the next 40ms backoff is over the maximum wait
+	assert.Error(t, c.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+	assert.Equal(t, 3, broken.calls)
+}
+
+func TestCompositeErrorAs(t *testing.T) {
+	err := CompositeError{"consul": fmt.Errorf("registering: %w", &net.OpError{Op: "dial"})}
+
+	var opErr *net.OpError
+	assert.True(t, err.As(&opErr))
+	assert.Equal(t, "dial", opErr.Op)
+	assert.False(t, err.Is(errBackendDown))
+}
+
+func TestNewComposite(t *testing.T) {
+	t.Setenv(envDNSFilePath, t.TempDir()+"/db.service.local")
+	r, err := New("dnsfile, dnsfile")
+	assert.NoError(t, err)
+	assert.Equal(t, compositeID, r.ID())
+	assert.Len(t, r.(clerk.MultiRegistry).Registries(), 2)
+
+	_, err = New("consul,unknown")
+	assert.ErrorIs(t, err, ErrUnknownRegistry)
+}
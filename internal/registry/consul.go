@@ -4,15 +4,24 @@ import (
 	"errors"
 	"fmt"
 	"log"
+	"net"
+	"strconv"
 	"strings"
 
 	consulapi "github.com/hashicorp/consul/api"
 	clerk "github.com/njasm/clerk/internal"
 	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
 )
 
 const consulID = "consul"
 
+// tagged address keys Consul uses for the addresses of each family
+const (
+	consulTaggedLANIPv4 = "lan_ipv4"
+	consulTaggedLANIPv6 = "lan_ipv6"
+)
+
 var ErrServiceIsNil = errors.New("service is nil")
 
 func NewConsul() (clerk.Registry, error) {
@@ -22,11 +31,26 @@ func NewConsul() (clerk.Registry, error) {
 		return nil, fmt.Errorf("error creating consul registry: %w", err)
 	}
 
-	return &Consul{client: client}, nil
+	meta, err := newMetaCodec()
+	if err != nil {
+		return nil, fmt.Errorf("error creating consul registry: %w", err)
+	}
+
+	c := &Consul{client: client, meta: meta}
+	if utils.EnvBool(envConsulKVEnabled) {
+		c.kv, err = newConsulKV(client)
+		if err != nil {
+			return nil, fmt.Errorf("error creating consul registry: %w", err)
+		}
+	}
+
+	return c, nil
 }
 
 type Consul struct {
 	client *consulapi.Client
+	kv     *consulKV
+	meta   metaCodec
 }
 
 func (c *Consul) ID() string {
@@ -50,24 +74,41 @@ func (c *Consul) Register(service *service.Service) error {
 		return ErrServiceIsNil
 	}
 
-	check := agentServiceCheck(service)
-	config := convertMetadataKeys(service.Config())
+	meta, err := c.meta.encode(consulMeta(service))
+	if err != nil {
+		return err
+	}
+
 	for _, instance := range service.Instances() {
 		registration := consulapi.AgentServiceRegistration{
 			Kind:    consulapi.ServiceKindTypical,
 			ID:      instance.ID,
 			Address: instance.IP,
 			Port:    instance.Port,
-			Name:    service.Name(),
-			Tags:    service.Tags(),
-			Meta:    config,
-			Check:   check,
+			Name:    instance.Name,
+			Tags:    service.InstanceTags(instance),
+			Meta:    meta,
+			Check:   agentServiceCheck(service, instance),
+		}
+
+		if instance.IPv6 != "" {
+			registration.TaggedAddresses = map[string]consulapi.ServiceAddress{
+				consulTaggedLANIPv4: {Address: instance.IP, Port: instance.Port},
+				consulTaggedLANIPv6: {Address: instance.IPv6, Port: instance.Port},
+			}
 		}
 
 		err := c.client.Agent().ServiceRegister(&registration)
 		if err != nil {
 			return err
 		}
+
+		if c.kv != nil {
+			err = c.kv.put(service, instance)
+			if err != nil {
+				return err
+			}
+		}
 	}
 
 	return nil
@@ -78,6 +119,15 @@ func (c *Consul) Unregister(service *service.Service) error {
 		return ErrServiceIsNil
 	}
 
+	if c.kv != nil {
+		for _, instance := range service.Instances() {
+			err := c.kv.delete(service, instance)
+			if err != nil {
+				log.Println(fmt.Errorf("consul: error deleting kv entries of %s: %w", instance.ID, err))
+			}
+		}
+	}
+
 	return c.client.Agent().ServiceDeregister(service.ID())
 }
 
@@ -93,13 +143,14 @@ func (c *Consul) Services() ([]*service.RegisteredService, error) {
 	}
 
 	for _, value := range services {
-		config := revertMetadataKeys(value.Meta)
+		config, attributes := splitConsulMeta(c.meta.decode(value.Meta))
 		s := &service.RegisteredService{
-			ID:     value.ID,
-			Name:   value.Service,
-			Port:   value.Port,
-			IP:     value.Address,
-			Config: config,
+			ID:         value.ID,
+			Name:       value.Service,
+			Port:       value.Port,
+			IP:         value.Address,
+			Attributes: attributes,
+			Config:     config,
 		}
 
 		rv = append(rv, s)
@@ -108,31 +159,26 @@ func (c *Consul) Services() ([]*service.RegisteredService, error) {
 	return rv, nil
 }
 
-func convertMetadataKeys(m map[string]string) map[string]string {
-	return metadataReplace(m, ".", "_")
-}
-
-func revertMetadataKeys(m map[string]string) map[string]string {
-	return metadataReplace(m, "_", ".")
-}
-
-func metadataReplace(m map[string]string, old, new string) map[string]string {
-	rv := map[string]string{}
-	for k, v := range m {
-		rv[strings.ReplaceAll(k, old, new)] = v
+// agentServiceCheck returns the check of instance, against the main port of service. UDP
+// and SCTP instances are checked on their own port, and only UDP instances with UDP checks.
+func agentServiceCheck(service *service.Service, instance service.Instance) *consulapi.AgentServiceCheck {
+	if !instance.TCP() {
+		return datagramServiceCheck(service, instance)
 	}
 
-	return rv
-}
+	port := service.CheckPort()
+	if port == 0 {
+		port = instance.Port
+	}
 
-func agentServiceCheck(service *service.Service) *consulapi.AgentServiceCheck {
 	check := new(consulapi.AgentServiceCheck)
+	address := net.JoinHostPort(instance.IP, strconv.Itoa(port))
 	if path, ok := service.GetConfig("consul.check.http"); ok {
-		check.HTTP = fmt.Sprintf("http://%s:%d%s", service.IPAddress(), service.Port(), path)
+		check.HTTP = fmt.Sprintf("http://%s%s", address, path)
 	}
 
 	if path, ok := service.GetConfig("consul.check.https"); ok {
-		check.HTTP = fmt.Sprintf("https://%s:%d%s", service.IPAddress(), service.Port(), path)
+		check.HTTP = fmt.Sprintf("https://%s%s", address, path)
 	}
 
 	if check.HTTP != "" {
@@ -142,12 +188,12 @@ func agentServiceCheck(service *service.Service) *consulapi.AgentServiceCheck {
 	}
 
 	if _, ok := service.GetConfig("consul.check.tcp"); ok {
-		check.TCP = fmt.Sprintf("%s:%d", service.IPAddress(), service.Port())
+		check.TCP = address
 	}
 
 	if _, ok := service.GetConfig("consul.check.grpc"); ok {
-		check.GRPC = fmt.Sprintf("%s:%d", service.IPAddress(), service.Port())
-		if useTLS, ok := service.GetConfig("consule.check.grpc.tls"); ok {
+		check.GRPC = address
+		if useTLS, ok := service.GetConfig("consul.check.grpc.tls"); ok {
 			if strings.Trim(strings.ToLower(useTLS), " ") == "true" {
 				check.GRPCUseTLS = true
 				if tlsSkipVerify, ok := service.GetConfig("consul.check.tls.skip.verify"); ok {
@@ -167,8 +213,25 @@ func agentServiceCheck(service *service.Service) *consulapi.AgentServiceCheck {
 
 	//TODO: check initial status, check cmd, check script, check TTL
 
-	if check.HTTP != "" || check.TCP != "" || check.GRPC != "" {
-		if timeout, ok := service.GetConfig("consul.check.timout"); ok {
+	return checkTimers(service, check)
+}
+
+// datagramServiceCheck returns the UDP check of a UDP instance. TCP based checks can't
+// reach UDP nor SCTP ports and are skipped, the service reports them in its diagnostics,
+// and Consul has no SCTP check.
+func datagramServiceCheck(service *service.Service, instance service.Instance) *consulapi.AgentServiceCheck {
+	check := new(consulapi.AgentServiceCheck)
+	if _, ok := service.GetConfig("consul.check.udp"); ok && instance.UDP() {
+		check.UDP = net.JoinHostPort(instance.IP, strconv.Itoa(instance.Port))
+	}
+
+	return checkTimers(service, check)
+}
+
+// checkTimers sets the timeout and interval of a check, and when to deregister the service.
+func checkTimers(service *service.Service, check *consulapi.AgentServiceCheck) *consulapi.AgentServiceCheck {
+	if check.HTTP != "" || check.TCP != "" || check.GRPC != "" || check.UDP != "" {
+		if timeout, ok := service.GetConfig("consul.check.timeout"); ok {
 			check.Timeout = timeout
 		} else {
 			check.Timeout = "2s"
@@ -0,0 +1,300 @@
+package registry
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/njasm/clerk/internal/constants"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const (
+	envConsulKVEnabled    = "CLERK_CONSUL_KV_ENABLED"
+	envConsulKVPath       = "CLERK_CONSUL_KV_PATH"
+	envConsulKVSessionTTL = "CLERK_CONSUL_KV_SESSION_TTL"
+
+	defaultConsulKVPath       = "services/{{.Name}}/{{.Instance}}"
+	defaultConsulKVSessionTTL = "15s"
+)
+
+var ErrKVNotAcquired = errors.New("kv key not acquired by clerk session")
+
+// kvPathData is the data available to the KV path template.
+type kvPathData struct {
+	Name     string
+	Instance string
+	IP       string
+	Port     int
+	Proto    string
+}
+
+// consulKV writes the `kv.` labels of a service into Consul KV. Every key is
+// acquired by a clerk owned session with the delete behaviour, so entries
+// are removed by Consul itself if clerk dies and stops renewing it. When the
+// session expires while clerk is alive, the entries are written again under a
+// new session. Keys still held by the session of a previous clerk are acquired in
+// the background once that session expires.
+type consulKV struct {
+	client *consulapi.Client
+	path   *template.Template
+	ttl    string
+
+	mu      sync.Mutex
+	session string
+	// entries written, by instance ID
+	entries map[string]map[string]string
+	// instances whose entries are acquired in the background
+	retrying map[string]bool
+}
+
+func newConsulKV(client *consulapi.Client) (*consulKV, error) {
+	path, err := template.New("kv").
+		Option("missingkey=error").
+		Parse(utils.EnvOrDefault(envConsulKVPath, defaultConsulKVPath))
+	if err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", envConsulKVPath, err)
+	}
+
+	ttl := utils.EnvOrDefault(envConsulKVSessionTTL, defaultConsulKVSessionTTL)
+	if _, err := time.ParseDuration(ttl); err != nil {
+		return nil, fmt.Errorf("error parsing %s: %w", envConsulKVSessionTTL, err)
+	}
+
+	return &consulKV{
+		client:   client,
+		path:     path,
+		ttl:      ttl,
+		entries:  map[string]map[string]string{},
+		retrying: map[string]bool{},
+	}, nil
+}
+
+// sessionID returns the current clerk session, creating and renewing a new one if needed.
+func (kv *consulKV) sessionID() (string, error) {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	if kv.session != "" {
+		return kv.session, nil
+	}
+
+	id, _, err := kv.client.Session().Create(&consulapi.SessionEntry{
+		Name:      "clerk",
+		TTL:       kv.ttl,
+		Behavior:  consulapi.SessionBehaviorDelete,
+		LockDelay: time.Millisecond,
+	}, nil)
+	if err != nil {
+		return "", fmt.Errorf("error creating consul session: %w", err)
+	}
+
+	go kv.renew(id)
+
+	kv.session = id
+	return id, nil
+}
+
+// renew keeps the session alive and, once it expired and Consul deleted its keys,
+// writes them again under a new session.
+func (kv *consulKV) renew(id string) {
+	err := kv.client.Session().RenewPeriodic(kv.ttl, id, nil, nil)
+	log.Println(fmt.Errorf("consul: kv session %s expired: %w", id, err))
+
+	kv.mu.Lock()
+	if kv.session == id {
+		kv.session = ""
+	}
+	kv.mu.Unlock()
+
+	retry, _ := time.ParseDuration(kv.ttl)
+	for {
+		err := kv.reacquire()
+		if err == nil {
+			return
+		}
+
+		log.Println(fmt.Errorf("consul: writing kv entries again, retry in %s: %w", retry, err))
+		time.Sleep(retry)
+	}
+}
+
+// reacquire writes every tracked entry under the current session.
+func (kv *consulKV) reacquire() error {
+	kv.mu.Lock()
+	ids := make([]string, 0, len(kv.entries))
+	for id := range kv.entries {
+		ids = append(ids, id)
+	}
+	kv.mu.Unlock()
+
+	if len(ids) == 0 {
+		return nil
+	}
+
+	return kv.acquire(ids...)
+}
+
+// retry acquires the entries of instance every session TTL, until they are acquired or
+// deleted.
+func (kv *consulKV) retry(id string) {
+	kv.mu.Lock()
+	if kv.retrying[id] {
+		kv.mu.Unlock()
+		return
+	}
+
+	kv.retrying[id] = true
+	kv.mu.Unlock()
+
+	defer func() {
+		kv.mu.Lock()
+		delete(kv.retrying, id)
+		kv.mu.Unlock()
+	}()
+
+	wait, _ := time.ParseDuration(kv.ttl)
+	for {
+		time.Sleep(wait)
+		kv.mu.Lock()
+		_, tracked := kv.entries[id]
+		kv.mu.Unlock()
+		if !tracked {
+			return
+		}
+
+		err := kv.acquire(id)
+		if err == nil {
+			return
+		}
+
+		log.Println(fmt.Errorf("consul: writing kv entries of %s, retry in %s: %w", id, wait, err))
+	}
+}
+
+func (kv *consulKV) prefix(srv *service.Service, instance service.Instance) (string, error) {
+	var buf bytes.Buffer
+	err := kv.path.Execute(&buf, kvPathData{
+		Name:     instance.Name,
+		Instance: instance.ID,
+		IP:       instance.IP,
+		Port:     instance.Port,
+		Proto:    instance.Proto,
+	})
+	if err != nil {
+		return "", fmt.Errorf("error rendering kv path: %w", err)
+	}
+
+	return strings.Trim(buf.String(), "/"), nil
+}
+
+// kvEntries maps the `kv.` labels of the service to their full KV key under prefix.
+// Dots in the label key become path separators, so `kv.db.host` is written to `<prefix>/db/host`.
+func kvEntries(srv *service.Service, prefix string) map[string]string {
+	rv := map[string]string{}
+	for key, value := range srv.ConfigWithPrefix(constants.CONFIG_CONSUL_KV_PREFIX) {
+		rv[prefix+"/"+strings.ReplaceAll(key, ".", "/")] = value
+	}
+
+	return rv
+}
+
+func (kv *consulKV) put(srv *service.Service, instance service.Instance) error {
+	prefix, err := kv.prefix(srv, instance)
+	if err != nil {
+		return err
+	}
+
+	entries := kvEntries(srv, prefix)
+	if len(entries) == 0 {
+		return nil
+	}
+
+	kv.mu.Lock()
+	kv.entries[instance.ID] = entries
+	kv.mu.Unlock()
+
+	err = kv.acquire(instance.ID)
+	if errors.Is(err, ErrKVNotAcquired) {
+		// held by the session of a previous clerk until it expires
+		log.Println(fmt.Errorf("consul: writing kv entries of %s in the background: %w", instance.ID, err))
+		go kv.retry(instance.ID)
+		return nil
+	}
+
+	return err
+}
+
+// acquire writes the tracked entries of the instances under the current session. Each
+// instance is written holding the lock, so the entries of a deleted instance are never
+// written again.
+func (kv *consulKV) acquire(ids ...string) error {
+	session, err := kv.sessionID()
+	if err != nil {
+		return err
+	}
+
+	var rv error
+	for _, id := range ids {
+		if err := kv.acquireInstance(session, id); err != nil {
+			rv = err
+		}
+	}
+
+	return rv
+}
+
+func (kv *consulKV) acquireInstance(session, id string) error {
+	kv.mu.Lock()
+	defer kv.mu.Unlock()
+
+	for key, value := range kv.entries[id] {
+		ok, _, err := kv.client.KV().Acquire(&consulapi.KVPair{
+			Key:     key,
+			Value:   []byte(value),
+			Session: session,
+		}, nil)
+		if err != nil {
+			return err
+		}
+
+		if !ok {
+			return fmt.Errorf("%w: %s", ErrKVNotAcquired, key)
+		}
+	}
+
+	return nil
+}
+
+// delete removes the keys written for instance, never the other keys under its prefix.
+func (kv *consulKV) delete(srv *service.Service, instance service.Instance) error {
+	kv.mu.Lock()
+	entries, ok := kv.entries[instance.ID]
+	delete(kv.entries, instance.ID)
+	kv.mu.Unlock()
+
+	// written by a previous run of clerk
+	if !ok {
+		prefix, err := kv.prefix(srv, instance)
+		if err != nil {
+			return err
+		}
+
+		entries = kvEntries(srv, prefix)
+	}
+
+	for key := range entries {
+		if _, err := kv.client.KV().Delete(key, nil); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,189 @@
+package registry
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	consulapi "github.com/hashicorp/consul/api"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeConsulKV answers the session and kv requests of consulKV, the first session
+// expires on its first renewal. Held keys can't be acquired.
+type fakeConsulKV struct {
+	mu       sync.Mutex
+	sessions int
+	acquired map[string]string
+	held     map[string]bool
+	deleted  []string
+}
+
+func (f *fakeConsulKV) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch {
+	case r.URL.Path == "/v1/session/create":
+		f.sessions++
+		fmt.Fprintf(w, `{"ID":"s%d"}`, f.sessions)
+	case r.URL.Path == "/v1/session/renew/s1":
+		w.WriteHeader(http.StatusNotFound)
+	case strings.HasPrefix(r.URL.Path, "/v1/session/renew/"):
+		fmt.Fprint(w, `[{"TTL":"1h"}]`)
+	case r.Method == http.MethodPut && f.held[strings.TrimPrefix(r.URL.Path, "/v1/kv/")]:
+		fmt.Fprint(w, "false")
+	case r.Method == http.MethodPut:
+		f.acquired[strings.TrimPrefix(r.URL.Path, "/v1/kv/")] = r.URL.Query().Get("acquire")
+		fmt.Fprint(w, "true")
+	case r.Method == http.MethodDelete:
+		f.deleted = append(f.deleted, strings.TrimPrefix(r.URL.Path, "/v1/kv/"))
+		fmt.Fprint(w, "true")
+	}
+}
+
+func (f *fakeConsulKV) sessionOf(key string) string {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.acquired[key]
+}
+
+func TestConsulKVEntries(t *testing.T) {
+	t.Setenv(envConsulKVPath, "services/{{.Name}}/{{.Instance}}/")
+	kv, err := newConsulKV(nil)
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":              "web",
+		"com.github.njasm.clerk.kv.db.host":        "db.local",
+		"com.github.njasm.clerk.kv.feature":        "on",
+		"com.github.njasm.clerk.consul.check.http": "/health",
+	})
+
+	prefix, err := kv.prefix(srv, srv.Instances()[srv.ID()])
+	assert.NoError(t, err)
+	assert.Equal(t, "services/web/web:tcp:80:host", prefix)
+
+	assert.Equal(t, map[string]string{
+		"services/web/web:tcp:80:host/db/host": "db.local",
+		"services/web/web:tcp:80:host/feature": "on",
+	}, kvEntries(srv, prefix))
+}
+
+func TestConsulKVInvalidConfig(t *testing.T) {
+	t.Setenv(envConsulKVPath, "services/{{.Name")
+	_, err := newConsulKV(nil)
+	assert.Error(t, err)
+
+	t.Setenv(envConsulKVPath, "")
+	t.Setenv(envConsulKVSessionTTL, "forever")
+	_, err = newConsulKV(nil)
+	assert.Error(t, err)
+}
+
+func TestConsulKVWritesAgainUnderNewSession(t *testing.T) {
+	fake := &fakeConsulKV{acquired: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client, err := consulapi.NewClient(&consulapi.Config{Address: server.URL})
+	assert.NoError(t, err)
+
+	t.Setenv(envConsulKVPath, "services/{{.Name}}/")
+	t.Setenv(envConsulKVSessionTTL, "20ms")
+	kv, err := newConsulKV(client)
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.kv.db.host": "db.local",
+		"com.github.njasm.clerk.kv.feature": "on",
+	})
+
+	instance := srv.Instances()[srv.ID()]
+	assert.NoError(t, kv.put(srv, instance))
+	assert.Equal(t, "s1", fake.sessionOf("services/web/db/host"))
+
+	assert.Eventually(t, func() bool {
+		return fake.sessionOf("services/web/db/host") == "s2" && fake.sessionOf("services/web/feature") == "s2"
+	}, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, kv.delete(srv, instance))
+
+	fake.mu.Lock()
+	defer fake.mu.Unlock()
+
+	sort.Strings(fake.deleted)
+	assert.Equal(t, []string{"services/web/db/host", "services/web/feature"}, fake.deleted)
+}
+
+func TestConsulKVAcquiresHeldKeysInBackground(t *testing.T) {
+	fake := &fakeConsulKV{acquired: map[string]string{}, held: map[string]bool{"services/web/feature": true}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client, err := consulapi.NewClient(&consulapi.Config{Address: server.URL})
+	assert.NoError(t, err)
+
+	t.Setenv(envConsulKVPath, "services/{{.Name}}/")
+	t.Setenv(envConsulKVSessionTTL, "10ms")
+	kv, err := newConsulKV(client)
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.kv.feature": "on",
+	})
+
+	instance := srv.Instances()[srv.ID()]
+	assert.NoError(t, kv.put(srv, instance))
+	assert.Equal(t, "", fake.sessionOf("services/web/feature"))
+
+	// the session of the previous clerk expired
+	fake.mu.Lock()
+	delete(fake.held, "services/web/feature")
+	fake.mu.Unlock()
+
+	assert.Eventually(t, func() bool {
+		return fake.sessionOf("services/web/feature") != ""
+	}, time.Second, 5*time.Millisecond)
+
+	assert.NoError(t, kv.delete(srv, instance))
+}
+
+func TestConsulKVDeletedEntriesNotWrittenAgain(t *testing.T) {
+	fake := &fakeConsulKV{acquired: map[string]string{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	client, err := consulapi.NewClient(&consulapi.Config{Address: server.URL})
+	assert.NoError(t, err)
+
+	t.Setenv(envConsulKVPath, "services/{{.Name}}/")
+	t.Setenv(envConsulKVSessionTTL, "1h")
+	kv, err := newConsulKV(client)
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.kv.feature": "on",
+	})
+
+	instance := srv.Instances()[srv.ID()]
+	assert.NoError(t, kv.put(srv, instance))
+	assert.NoError(t, kv.delete(srv, instance))
+
+	// acquired by a reacquire that listed the instance before it was deleted
+	fake.mu.Lock()
+	fake.acquired = map[string]string{}
+	fake.mu.Unlock()
+
+	assert.NoError(t, kv.acquire(instance.ID))
+	assert.Equal(t, "", fake.sessionOf("services/web/feature"))
+}
@@ -0,0 +1,279 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const (
+	envConsulMetaStripPrefix = "CLERK_CONSUL_META_STRIP_PREFIX"
+	envConsulMetaPolicy      = "CLERK_CONSUL_META_POLICY"
+
+	// Consul agent limits, see structs.ValidateServiceMetadata
+	consulMetaMaxPairs       = 64
+	consulMetaMaxKeyLength   = 128
+	consulMetaMaxValueLength = 512
+	consulMetaReservedPrefix = "consul-"
+)
+
+// metaPolicy decides what happens to metadata that doesn't fit Consul's Meta constraints.
+type metaPolicy string
+
+const (
+	// metaPolicySkip drops the offending pair and logs it
+	metaPolicySkip metaPolicy = "skip"
+	// metaPolicyTruncate cuts keys and values to the maximum length, the key is no longer reversible
+	metaPolicyTruncate metaPolicy = "truncate"
+	// metaPolicyError fails the registration
+	metaPolicyError metaPolicy = "error"
+)
+
+var ErrInvalidMetadata = errors.New("invalid consul metadata")
+
+// metaCodec converts clerk labels into Consul Meta keys and back.
+//
+// Consul only accepts `[a-zA-Z0-9_-]` in meta keys, so keys are encoded with `-`
+// as escape character: `.` becomes `_`, `_` becomes `-u`, `-` becomes `-d` and any
+// other byte becomes `-xHH`. `com.github.njasm.clerk.my_key` is published as
+// `com_github_njasm_clerk_my-ukey` and decodes back to the original label.
+// Keys are published with the label prefix of this clerk, see service.LabelPrefix.
+type metaCodec struct {
+	stripPrefix bool
+	policy      metaPolicy
+	prefix      string
+}
+
+func newMetaCodec() (metaCodec, error) {
+	policy := metaPolicy(strings.ToLower(utils.EnvOrDefault(envConsulMetaPolicy, string(metaPolicySkip))))
+	switch policy {
+	case metaPolicySkip, metaPolicyTruncate, metaPolicyError:
+	default:
+		return metaCodec{}, fmt.Errorf("unknown %s: %q", envConsulMetaPolicy, policy)
+	}
+
+	return metaCodec{
+		stripPrefix: utils.EnvBool(envConsulMetaStripPrefix),
+		policy:      policy,
+		prefix:      service.LabelPrefix(),
+	}, nil
+}
+
+// encode converts config labels into valid Consul Meta, applying the codec policy
+// to keys and values that are too long, to keys that clash once encoded and to pairs
+// above Consul's limit. Config labels are encoded first, they win the clashes.
+func (c metaCodec) encode(m map[string]string) (map[string]string, error) {
+	labels := make([]string, 0, len(m))
+	for k := range m {
+		labels = append(labels, k)
+	}
+
+	// sorted, so the pairs kept over the limit are always the same
+	sort.Slice(labels, func(i, j int) bool {
+		iConfig, jConfig := strings.HasPrefix(labels[i], constants.CONFIG_PREFIX), strings.HasPrefix(labels[j], constants.CONFIG_PREFIX)
+		if iConfig != jConfig {
+			return iConfig
+		}
+
+		return labels[i] < labels[j]
+	})
+
+	rv, encoded := map[string]string{}, map[string]string{}
+	for _, label := range labels {
+		key, value := label, m[label]
+		if c.stripPrefix {
+			key = strings.TrimPrefix(key, constants.CONFIG_PREFIX)
+		} else if suffix := strings.TrimPrefix(key, constants.CONFIG_PREFIX); suffix != key {
+			key = c.labelPrefix() + suffix
+		}
+
+		key = encodeMetaKey(key)
+		if strings.HasPrefix(key, consulMetaReservedPrefix) {
+			if err := c.violation(label, "uses the reserved %q prefix", consulMetaReservedPrefix); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if len(key) > consulMetaMaxKeyLength {
+			if err := c.violation(label, "key is longer than %d characters", consulMetaMaxKeyLength); err != nil {
+				return nil, err
+			}
+
+			if c.policy != metaPolicyTruncate {
+				continue
+			}
+
+			key = key[:consulMetaMaxKeyLength]
+		}
+
+		if len(value) > consulMetaMaxValueLength {
+			if err := c.violation(label, "value is longer than %d characters", consulMetaMaxValueLength); err != nil {
+				return nil, err
+			}
+
+			if c.policy != metaPolicyTruncate {
+				continue
+			}
+
+			value = value[:consulMetaMaxValueLength]
+		}
+
+		if other, ok := encoded[key]; ok {
+			if err := c.violation(label, "is %s once encoded, and %s is kept", key, other); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		if len(rv) == consulMetaMaxPairs {
+			if err := c.violation(label, "more than %d metadata pairs", consulMetaMaxPairs); err != nil {
+				return nil, err
+			}
+
+			continue
+		}
+
+		rv[key], encoded[key] = value, label
+	}
+
+	return rv, nil
+}
+
+// decode converts Consul Meta back into config labels.
+func (c metaCodec) decode(m map[string]string) map[string]string {
+	rv := map[string]string{}
+	for k, v := range m {
+		key := decodeMetaKey(k)
+		if c.stripPrefix {
+			key = constants.CONFIG_PREFIX + key
+		} else if suffix := strings.TrimPrefix(key, c.labelPrefix()); suffix != key {
+			key = constants.CONFIG_PREFIX + suffix
+		}
+
+		rv[key] = v
+	}
+
+	return rv
+}
+
+// consulMeta returns what is published as Consul Meta for service: its attributes under
+// their own key and its config labels, which win when both use the same key. The
+// `attributes.<key>` labels are attributes already and aren't published twice.
+func consulMeta(srv *service.Service) map[string]string {
+	rv := map[string]string{}
+	for key, value := range srv.Attributes() {
+		rv[key] = value
+	}
+
+	for key, value := range srv.Config() {
+		if !strings.HasPrefix(key, constants.CONFIG_SERVICE_ATTRIBUTES+".") {
+			rv[key] = value
+		}
+	}
+
+	return rv
+}
+
+// splitConsulMeta separates decoded Meta into config labels and attributes. With
+// CLERK_CONSUL_META_STRIP_PREFIX the two can't be told apart and everything is config.
+func splitConsulMeta(meta map[string]string) (map[string]string, map[string]string) {
+	config, attributes := map[string]string{}, map[string]string{}
+	for key, value := range meta {
+		if strings.HasPrefix(key, constants.CONFIG_PREFIX) {
+			config[key] = value
+			continue
+		}
+
+		attributes[key] = value
+	}
+
+	return config, attributes
+}
+
+func (c metaCodec) labelPrefix() string {
+	if c.prefix == "" {
+		return constants.CONFIG_PREFIX
+	}
+
+	return c.prefix
+}
+
+func (c metaCodec) violation(label, format string, args ...interface{}) error {
+	err := fmt.Errorf("%w: %s %s", ErrInvalidMetadata, label, fmt.Sprintf(format, args...))
+	if c.policy == metaPolicyError {
+		return err
+	}
+
+	log.Println(fmt.Errorf("consul: %s policy applied: %w", c.policy, err))
+	return nil
+}
+
+func encodeMetaKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		switch ch := key[i]; {
+		case ch == '.':
+			b.WriteByte('_')
+		case ch == '_':
+			b.WriteString("-u")
+		case ch == '-':
+			b.WriteString("-d")
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+			b.WriteByte(ch)
+		default:
+			fmt.Fprintf(&b, "-x%02x", ch)
+		}
+	}
+
+	return b.String()
+}
+
+// decodeMetaKey reverses encodeMetaKey, malformed escapes are kept as they are.
+func decodeMetaKey(key string) string {
+	var b strings.Builder
+	for i := 0; i < len(key); i++ {
+		ch := key[i]
+		if ch == '_' {
+			b.WriteByte('.')
+			continue
+		}
+
+		if ch != '-' || i+1 >= len(key) {
+			b.WriteByte(ch)
+			continue
+		}
+
+		switch key[i+1] {
+		case 'u':
+			b.WriteByte('_')
+			i++
+		case 'd':
+			b.WriteByte('-')
+			i++
+		case 'x':
+			if i+3 < len(key) {
+				if value, err := strconv.ParseUint(key[i+2:i+4], 16, 8); err == nil {
+					b.WriteByte(byte(value))
+					i += 3
+					continue
+				}
+			}
+
+			b.WriteByte(ch)
+		default:
+			b.WriteByte(ch)
+		}
+	}
+
+	return b.String()
+}
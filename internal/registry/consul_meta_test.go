@@ -0,0 +1,141 @@
+package registry
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetaKeyRoundTrip(t *testing.T) {
+	scenarios := map[string]string{
+		"com.github.njasm.clerk.register":    "com_github_njasm_clerk_register",
+		"com.github.njasm.clerk.my_key":      "com_github_njasm_clerk_my-ukey",
+		"com.github.njasm.clerk.my-key":      "com_github_njasm_clerk_my-dkey",
+		"com.github.njasm.clerk.my key/path": "com_github_njasm_clerk_my-x20key-x2fpath",
+		"a._b":                               "a_-ub",
+	}
+
+	for label, expected := range scenarios {
+		t.Run(label, func(t *testing.T) {
+			encoded := encodeMetaKey(label)
+			assert.Equal(t, expected, encoded)
+			assert.Equal(t, label, decodeMetaKey(encoded))
+		})
+	}
+
+	assert.Equal(t, "a-zb-x2", decodeMetaKey("a-zb-x2"))
+}
+
+func TestMetaCodecStripPrefix(t *testing.T) {
+	codec := metaCodec{stripPrefix: true, policy: metaPolicySkip}
+	labels := map[string]string{"com.github.njasm.clerk.consul.check.http": "/health"}
+
+	meta, err := codec.encode(labels)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"consul_check_http": "/health"}, meta)
+	assert.Equal(t, labels, codec.decode(meta))
+}
+
+func TestMetaCodecLabelPrefix(t *testing.T) {
+	codec := metaCodec{policy: metaPolicySkip, prefix: "com.acme.discovery.payments."}
+	labels := map[string]string{"com.github.njasm.clerk.consul.check.http": "/health"}
+
+	meta, err := codec.encode(labels)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"com_acme_discovery_payments_consul_check_http": "/health"}, meta)
+	assert.Equal(t, labels, codec.decode(meta))
+
+	// meta of another namespace isn't decoded as config of this one
+	other := metaCodec{policy: metaPolicySkip}.decode(map[string]string{"com_acme_discovery_search_name": "search"})
+	assert.Equal(t, map[string]string{"com.acme.discovery.search.name": "search"}, other)
+}
+
+func TestMetaCodecPolicies(t *testing.T) {
+	longKey := "com.github.njasm.clerk." + strings.Repeat("k", consulMetaMaxKeyLength)
+	labels := map[string]string{
+		longKey:                        "value",
+		"com.github.njasm.clerk.value": strings.Repeat("v", consulMetaMaxValueLength+1),
+		"consul-reserved":              "value",
+	}
+
+	meta, err := metaCodec{policy: metaPolicySkip}.encode(labels)
+	assert.NoError(t, err)
+	assert.Empty(t, meta)
+
+	meta, err = metaCodec{policy: metaPolicyTruncate}.encode(labels)
+	assert.NoError(t, err)
+	assert.Len(t, meta, 2)
+	assert.Len(t, meta["com_github_njasm_clerk_value"], consulMetaMaxValueLength)
+
+	_, err = metaCodec{policy: metaPolicyError}.encode(labels)
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+}
+
+func TestMetaCodecMaxPairs(t *testing.T) {
+	labels := map[string]string{}
+	for i := 0; i < consulMetaMaxPairs+10; i++ {
+		labels[fmt.Sprintf("com.github.njasm.clerk.key%03d", i)] = "value"
+	}
+
+	meta, err := metaCodec{policy: metaPolicySkip}.encode(labels)
+	assert.NoError(t, err)
+	assert.Len(t, meta, consulMetaMaxPairs)
+	assert.Contains(t, meta, "com_github_njasm_clerk_key000")
+	assert.NotContains(t, meta, fmt.Sprintf("com_github_njasm_clerk_key%03d", consulMetaMaxPairs))
+
+	_, err = metaCodec{policy: metaPolicyError}.encode(labels)
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+}
+
+func TestNewMetaCodec(t *testing.T) {
+	t.Setenv(envConsulMetaPolicy, "Truncate")
+	codec, err := newMetaCodec()
+	assert.NoError(t, err)
+	assert.Equal(t, metaPolicyTruncate, codec.policy)
+
+	t.Setenv(envConsulMetaPolicy, "ignore")
+	_, err = newMetaCodec()
+	assert.Error(t, err)
+}
+
+func TestConsulMetaAttributes(t *testing.T) {
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.register":   "true",
+		"com.github.njasm.clerk.attributes": `url:http://api:8080/v1,owner:team-a`,
+	})
+
+	codec := metaCodec{policy: metaPolicySkip}
+	meta, err := codec.encode(consulMeta(srv))
+	assert.NoError(t, err)
+	assert.Equal(t, "http://api:8080/v1", meta["url"])
+	assert.Equal(t, "team-a", meta["owner"])
+	assert.Equal(t, "true", meta["com_github_njasm_clerk_register"])
+
+	config, attributes := splitConsulMeta(codec.decode(meta))
+	assert.Equal(t, srv.Config(), config)
+	assert.Equal(t, srv.Attributes(), attributes)
+}
+
+func TestConsulMetaClashes(t *testing.T) {
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":            "web",
+		"com.github.njasm.clerk.attributes":      "name:from-attribute",
+		"com.github.njasm.clerk.attributes.team": "core",
+	})
+
+	// attributes.<key> labels are only published as attributes
+	meta := consulMeta(srv)
+	assert.Equal(t, "core", meta["team"])
+	assert.NotContains(t, meta, "com.github.njasm.clerk.attributes.team")
+
+	// the name label and the name attribute are both name once encoded, the label wins
+	encoded, err := metaCodec{stripPrefix: true, policy: metaPolicySkip}.encode(meta)
+	assert.NoError(t, err)
+	assert.Equal(t, "web", encoded["name"])
+	assert.Equal(t, "core", encoded["team"])
+
+	_, err = metaCodec{stripPrefix: true, policy: metaPolicyError}.encode(meta)
+	assert.ErrorIs(t, err, ErrInvalidMetadata)
+}
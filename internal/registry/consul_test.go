@@ -0,0 +1,69 @@
+package registry
+
+import (
+	"testing"
+
+	"github.com/njasm/clerk/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAgentServiceCheckAddress(t *testing.T) {
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.consul.check.http": "/health",
+		"com.github.njasm.clerk.consul.check.tcp":  "true",
+		"com.github.njasm.clerk.consul.check.grpc": "true",
+	})
+
+	check := agentServiceCheck(srv, service.Instance{IP: "10.0.0.2", Port: 80})
+	assert.Equal(t, "http://10.0.0.2:80/health", check.HTTP)
+	assert.Equal(t, "10.0.0.2:80", check.TCP)
+	assert.Equal(t, "10.0.0.2:80", check.GRPC)
+
+	check = agentServiceCheck(srv, service.Instance{IP: "fd00::2", Port: 80})
+	assert.Equal(t, "http://[fd00::2]:80/health", check.HTTP)
+	assert.Equal(t, "[fd00::2]:80", check.TCP)
+	assert.Equal(t, "[fd00::2]:80", check.GRPC)
+}
+
+func TestAgentServiceCheckDatagram(t *testing.T) {
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.ports":             "53/udp",
+		"com.github.njasm.clerk.consul.check.tcp":  "true",
+		"com.github.njasm.clerk.consul.check.http": "/health",
+		"com.github.njasm.clerk.consul.check.udp":  "true",
+	})
+
+	// TCP based checks are skipped, the UDP check is against the instance port
+	check := agentServiceCheck(srv, service.Instance{IP: "10.0.0.2", Port: 53, Proto: "udp"})
+	assert.Equal(t, "", check.HTTP)
+	assert.Equal(t, "", check.TCP)
+	assert.Equal(t, "10.0.0.2:53", check.UDP)
+	assert.Equal(t, "10s", check.Interval)
+
+	// and there's no check of SCTP ports
+	check = agentServiceCheck(srv, service.Instance{IP: "10.0.0.2", Port: 3868, Proto: "sctp"})
+	assert.Equal(t, "", check.TCP)
+	assert.Equal(t, "", check.UDP)
+	assert.Equal(t, "", check.Interval)
+
+	// UDP checks only apply to UDP instances
+	check = agentServiceCheck(srv, service.Instance{IP: "10.0.0.2", Port: 80, Proto: "tcp"})
+	assert.Equal(t, "10.0.0.2:80", check.TCP)
+	assert.Equal(t, "", check.UDP)
+}
+
+func TestAgentServiceCheckFirstTCPPort(t *testing.T) {
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.ports":             "53/udp,8080/tcp,9090/tcp",
+		"com.github.njasm.clerk.consul.check.http": "/health",
+	})
+
+	for _, instance := range srv.Instances() {
+		check := agentServiceCheck(srv, instance)
+		if instance.TCP() {
+			assert.Equal(t, "http://10.0.0.2:8080/health", check.HTTP)
+		} else {
+			assert.Equal(t, "", check.HTTP)
+		}
+	}
+}
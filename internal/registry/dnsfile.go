@@ -0,0 +1,242 @@
+package registry
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const dnsFileID = "dnsfile"
+
+const (
+	envDNSFileFormat = "CLERK_DNSFILE_FORMAT"
+	envDNSFilePath   = "CLERK_DNSFILE_PATH"
+	envDNSFileZone   = "CLERK_DNSFILE_ZONE"
+	envDNSFileTTL    = "CLERK_DNSFILE_TTL"
+
+	defaultDNSFileZone = "service.local."
+	defaultDNSFileTTL  = "30"
+
+	dnsFileFormatZone  = "zone"
+	dnsFileFormatHosts = "hosts"
+)
+
+var invalidDNSLabel = regexp.MustCompile(`[^a-z0-9-]+`)
+
+func NewDNSFile() (clerk.Registry, error) {
+	format := strings.ToLower(utils.EnvOrDefault(envDNSFileFormat, dnsFileFormatZone))
+	if format != dnsFileFormatZone && format != dnsFileFormatHosts {
+		return nil, fmt.Errorf("error creating dns file registry: unknown %s: %q", envDNSFileFormat, format)
+	}
+
+	defaultPath := "/etc/clerk/db." + strings.TrimSuffix(defaultDNSFileZone, ".")
+	if format == dnsFileFormatHosts {
+		defaultPath = "/etc/clerk/hosts"
+	}
+
+	ttl, err := strconv.Atoi(utils.EnvOrDefault(envDNSFileTTL, defaultDNSFileTTL))
+	if err != nil {
+		return nil, fmt.Errorf("error creating dns file registry: %w", err)
+	}
+
+	d := newDNSFile(utils.EnvOrDefault(envDNSFilePath, defaultPath), format, utils.EnvOrDefault(envDNSFileZone, defaultDNSFileZone), ttl)
+
+	// start from an empty file, so stale records of a previous run aren't served
+	return d, d.write()
+}
+
+func newDNSFile(path, format, zone string, ttl int) *DNSFile {
+	return &DNSFile{
+		path:      path,
+		format:    format,
+		zone:      strings.TrimSuffix(zone, ".") + ".",
+		ttl:       ttl,
+		instances: instanceSet{},
+	}
+}
+
+// DNSFile renders every registered instance into a DNS zone file, with A/AAAA and
+// `_name._proto` SRV records, or into an /etc/hosts style file. The file is rewritten
+// atomically on every change, so CoreDNS `file`/`hosts` plugins can serve it.
+type DNSFile struct {
+	path   string
+	format string
+	zone   string
+	ttl    int
+
+	mu        sync.Mutex
+	serial    uint32
+	instances instanceSet
+}
+
+func (d *DNSFile) ID() string {
+	return dnsFileID
+}
+
+func (d *DNSFile) Ping() error {
+	return nil
+}
+
+func (d *DNSFile) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	for _, instance := range service.Instances() {
+		if !dnsNamed(registeredInstance(service, instance)) {
+			log.Println(fmt.Errorf("dnsfile: %s: %q has no valid DNS label, skipped", instance.ID, instance.Name))
+		}
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.instances.add(service)
+	return d.write()
+}
+
+func (d *DNSFile) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	d.instances.remove(service)
+	return d.write()
+}
+
+func (d *DNSFile) Services() ([]*service.RegisteredService, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	return d.instances.sorted(), nil
+}
+
+func (d *DNSFile) write() error {
+	var data []byte
+	if d.format == dnsFileFormatHosts {
+		data = d.hosts()
+	} else {
+		data = d.zoneFile()
+	}
+
+	return utils.WriteFileAtomic(d.path, data, 0644)
+}
+
+func (d *DNSFile) zoneFile() []byte {
+	// the serial must always grow, including across restarts
+	d.serial++
+	if now := uint32(time.Now().Unix()); now > d.serial {
+		d.serial = now
+	}
+
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "$ORIGIN %s\n$TTL %d\n", d.zone, d.ttl)
+	fmt.Fprintf(&b, "@ IN SOA ns.%s hostmaster.%s %d 3600 600 86400 %d\n", d.zone, d.zone, d.serial, d.ttl)
+	fmt.Fprintf(&b, "@ IN NS ns.%s\n", d.zone)
+	b.WriteString("ns IN A 127.0.0.1\n")
+
+	// instances of a name on the same address share its records
+	written := map[string]bool{}
+	record := func(name, rtype, ip string) {
+		line := fmt.Sprintf("%s IN %s %s\n", name, rtype, ip)
+		if !written[line] {
+			written[line] = true
+			b.WriteString(line)
+		}
+	}
+
+	for _, instance := range d.instances.sorted() {
+		addresses := dnsAddresses(instance)
+		if len(addresses) == 0 || !dnsNamed(instance) {
+			continue
+		}
+
+		proto := strings.ToLower(instance.Proto)
+		if proto == "" {
+			proto = service.PROTO_TCP
+		}
+
+		name := dnsLabel(instance.Name)
+		target := dnsLabel(instance.ID) + "." + name
+		for _, ip := range addresses {
+			rtype := "A"
+			if ip.To4() == nil {
+				rtype = "AAAA"
+			}
+
+			record(name, rtype, ip.String())
+			record(target, rtype, ip.String())
+		}
+
+		fmt.Fprintf(&b, "_%s._%s IN SRV 0 0 %d %s.%s\n", srvName(name, proto), proto, instance.Port, target, d.zone)
+	}
+
+	return b.Bytes()
+}
+
+// dnsAddresses returns the valid addresses of instance, its IPv6 one included.
+func dnsAddresses(instance *service.RegisteredService) []net.IP {
+	rv := []net.IP{}
+	for _, address := range []string{instance.IP, instance.IPv6} {
+		if ip := net.ParseIP(address); ip != nil {
+			rv = append(rv, ip)
+		}
+	}
+
+	return rv
+}
+
+// dnsNamed reports whether the name and ID of instance make valid DNS labels.
+func dnsNamed(instance *service.RegisteredService) bool {
+	return dnsLabel(instance.Name) != "" && dnsLabel(instance.ID) != ""
+}
+
+func (d *DNSFile) hosts() []byte {
+	var b bytes.Buffer
+	zone := strings.TrimSuffix(d.zone, ".")
+	for _, instance := range d.instances.sorted() {
+		if !dnsNamed(instance) {
+			continue
+		}
+
+		name := dnsLabel(instance.Name)
+		for _, ip := range dnsAddresses(instance) {
+			fmt.Fprintf(&b, "%s %s.%s %s.%s.%s\n", ip, name, zone, dnsLabel(instance.ID), name, zone)
+		}
+	}
+
+	return b.Bytes()
+}
+
+// srvName returns the RFC 2782 service name of an instance, without the protocol suffix
+// of the PROTOCOL_NAME naming, so dns-udp is served as _dns._udp.
+func srvName(name, proto string) string {
+	if trimmed := strings.TrimSuffix(name, "-"+proto); trimmed != "" {
+		return trimmed
+	}
+
+	return name
+}
+
+// dnsLabel turns value into a valid DNS label.
+func dnsLabel(value string) string {
+	label := strings.Trim(invalidDNSLabel.ReplaceAllString(strings.ToLower(value), "-"), "-")
+	if len(label) > 63 {
+		label = strings.TrimRight(label[:63], "-")
+	}
+
+	return label
+}
@@ -0,0 +1,136 @@
+package registry
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDNSFileZone(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.service.local")
+	d := newDNSFile(path, dnsFileFormatZone, "service.local", 30)
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "Web_App"})
+
+	assert.NoError(t, d.Register(srv))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	zone := string(data)
+	assert.Contains(t, zone, "$ORIGIN service.local.\n")
+	assert.Contains(t, zone, "web-app IN A 10.0.0.2\n")
+	assert.Contains(t, zone, "web-app-tcp-80-host.web-app IN A 10.0.0.2\n")
+	assert.Contains(t, zone, "_web-app._tcp IN SRV 0 0 80 web-app-tcp-80-host.web-app.service.local.\n")
+
+	serial := d.serial
+	services, err := d.Services()
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, "Web_App", services[0].Name)
+
+	assert.NoError(t, d.Unregister(srv))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.NotContains(t, string(data), "10.0.0.2")
+	assert.Greater(t, d.serial, serial)
+}
+
+func TestDNSFileHosts(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "hosts")
+	d := newDNSFile(path, dnsFileFormatHosts, "service.local.", 30)
+
+	assert.NoError(t, d.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2 web.service.local web-tcp-80-host.web.service.local\n", string(data))
+}
+
+func TestDNSLabel(t *testing.T) {
+	assert.Equal(t, "web-tcp-80-host", dnsLabel("web:tcp:80:host"))
+	assert.Equal(t, "my-service", dnsLabel("/My_Service/"))
+	assert.Equal(t, strings.Repeat("a", 63), dnsLabel(strings.Repeat("a", 70)))
+}
+
+func TestDNSFileZoneProtocolName(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.service.local")
+	d := newDNSFile(path, dnsFileFormatZone, "service.local", 30)
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":         "dns",
+		"com.github.njasm.clerk.ports":        "53/udp,53/tcp",
+		"com.github.njasm.clerk.proto.naming": "name",
+	})
+
+	assert.NoError(t, d.Register(srv))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	zone := string(data)
+	assert.Contains(t, zone, "_dns._udp IN SRV 0 0 53 dns-udp-udp-53-host.dns-udp.service.local.\n")
+	assert.Contains(t, zone, "_dns._tcp IN SRV 0 0 53 dns-tcp-53-host.dns.service.local.\n")
+}
+
+func TestDNSFileZoneRecordsOncePerAddress(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.service.local")
+	d := newDNSFile(path, dnsFileFormatZone, "service.local", 30)
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":  "web",
+		"com.github.njasm.clerk.ports": "80/tcp,443/tcp",
+	})
+
+	assert.NoError(t, d.Register(srv))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	zone := string(data)
+	assert.Equal(t, 1, strings.Count(zone, "\nweb IN A 10.0.0.2\n"))
+	assert.Contains(t, zone, "_web._tcp IN SRV 0 0 80 web-tcp-80-host.web.service.local.\n")
+	assert.Contains(t, zone, "_web._tcp IN SRV 0 0 443 web-tcp-443-host.web.service.local.\n")
+}
+
+func TestDNSFileDualFamily(t *testing.T) {
+	srv := service.NewFrom(service.Container{
+		ID:           "abc123",
+		Name:         "web",
+		Hostname:     "host",
+		Labels:       map[string]string{"com.github.njasm.clerk.address.family": "dual"},
+		ExposedPorts: []string{"80/tcp"},
+		Networks: map[string]service.Network{
+			"bridge": {IPAddress: "10.0.0.2", GlobalIPv6Address: "fd00::2"},
+		},
+	})
+
+	path := filepath.Join(t.TempDir(), "db.service.local")
+	d := newDNSFile(path, dnsFileFormatZone, "service.local", 30)
+	assert.NoError(t, d.Register(srv))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	zone := string(data)
+	assert.Contains(t, zone, "web IN A 10.0.0.2\n")
+	assert.Contains(t, zone, "web IN AAAA fd00::2\n")
+	assert.Contains(t, zone, "web-tcp-80-host.web IN AAAA fd00::2\n")
+
+	path = filepath.Join(t.TempDir(), "hosts")
+	d = newDNSFile(path, dnsFileFormatHosts, "service.local", 30)
+	assert.NoError(t, d.Register(srv))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, "10.0.0.2 web.service.local web-tcp-80-host.web.service.local\nfd00::2 web.service.local web-tcp-80-host.web.service.local\n", string(data))
+}
+
+func TestDNSFileSkipsInvalidLabels(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "db.service.local")
+	d := newDNSFile(path, dnsFileFormatZone, "service.local", 30)
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "___"})
+
+	assert.NoError(t, d.Register(srv))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+
+	zone := string(data)
+	assert.NotContains(t, zone, "10.0.0.2")
+	assert.NotContains(t, zone, "SRV")
+}
@@ -0,0 +1,313 @@
+package registry
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const eurekaID = "eureka"
+
+const (
+	envEurekaURLs              = "CLERK_EUREKA_URLS"
+	envEurekaHeartbeatInterval = "CLERK_EUREKA_HEARTBEAT_INTERVAL"
+	envEurekaLeaseDuration     = "CLERK_EUREKA_LEASE_DURATION"
+	envEurekaStopStatus        = "CLERK_EUREKA_STOP_STATUS"
+
+	defaultEurekaURLs              = "http://127.0.0.1:8761/eureka"
+	defaultEurekaHeartbeatInterval = "30s"
+	defaultEurekaLeaseDuration     = "90s"
+
+	eurekaStatusUp           = "UP"
+	eurekaStatusDown         = "DOWN"
+	eurekaStatusOutOfService = "OUT_OF_SERVICE"
+)
+
+var ErrEurekaUnavailable = errors.New("no eureka server available")
+var ErrEurekaNotFound = errors.New("eureka instance not found")
+
+type eurekaPort struct {
+	Port    int    `json:"$"`
+	Enabled string `json:"@enabled"`
+}
+
+type eurekaDataCenterInfo struct {
+	Class string `json:"@class"`
+	Name  string `json:"name"`
+}
+
+type eurekaLeaseInfo struct {
+	RenewalIntervalInSecs int `json:"renewalIntervalInSecs"`
+	DurationInSecs        int `json:"durationInSecs"`
+}
+
+type eurekaInstance struct {
+	InstanceID       string               `json:"instanceId"`
+	HostName         string               `json:"hostName"`
+	App              string               `json:"app"`
+	IPAddr           string               `json:"ipAddr"`
+	VIPAddress       string               `json:"vipAddress"`
+	SecureVIPAddress string               `json:"secureVipAddress"`
+	Status           string               `json:"status"`
+	Port             eurekaPort           `json:"port"`
+	SecurePort       eurekaPort           `json:"securePort"`
+	DataCenterInfo   eurekaDataCenterInfo `json:"dataCenterInfo"`
+	LeaseInfo        eurekaLeaseInfo      `json:"leaseInfo"`
+	Metadata         map[string]string    `json:"metadata,omitempty"`
+}
+
+type eurekaApplications struct {
+	Applications struct {
+		Application []struct {
+			Name     string           `json:"name"`
+			Instance []eurekaInstance `json:"instance"`
+		} `json:"application"`
+	} `json:"applications"`
+}
+
+func NewEureka() (clerk.Registry, error) {
+	interval, err := time.ParseDuration(utils.EnvOrDefault(envEurekaHeartbeatInterval, defaultEurekaHeartbeatInterval))
+	if err != nil {
+		return nil, fmt.Errorf("error creating eureka registry: %w", err)
+	}
+
+	lease, err := time.ParseDuration(utils.EnvOrDefault(envEurekaLeaseDuration, defaultEurekaLeaseDuration))
+	if err != nil {
+		return nil, fmt.Errorf("error creating eureka registry: %w", err)
+	}
+
+	stopStatus := strings.ToUpper(utils.EnvOrDefault(envEurekaStopStatus, eurekaStatusDown))
+	if stopStatus != eurekaStatusDown && stopStatus != eurekaStatusOutOfService {
+		return nil, fmt.Errorf("error creating eureka registry: unknown %s: %q", envEurekaStopStatus, stopStatus)
+	}
+
+	e := newEureka(strings.Split(utils.EnvOrDefault(envEurekaURLs, defaultEurekaURLs), ","), &http.Client{Timeout: 5 * time.Second})
+	e.interval = interval
+	e.lease = lease
+	e.stopStatus = stopStatus
+
+	go func(e *Eureka, ticker *time.Ticker) {
+		for range ticker.C {
+			e.heartbeat()
+		}
+	}(e, time.NewTicker(e.interval))
+
+	return e, nil
+}
+
+func newEureka(urls []string, client *http.Client) *Eureka {
+	servers := []string{}
+	for _, u := range urls {
+		if u = strings.TrimRight(strings.TrimSpace(u), "/"); u != "" {
+			servers = append(servers, u)
+		}
+	}
+
+	return &Eureka{
+		servers:    servers,
+		client:     client,
+		interval:   30 * time.Second,
+		lease:      90 * time.Second,
+		stopStatus: eurekaStatusDown,
+		instances:  map[string]eurekaInstance{},
+	}
+}
+
+// Eureka registers every instance through the Eureka REST API, with the service name as app
+// name, and keeps them alive with periodic heartbeats. When a container stops its instances
+// are marked with the configured stop status and heartbeats stop, so Eureka evicts them once
+// their lease expires.
+type Eureka struct {
+	servers    []string
+	client     *http.Client
+	interval   time.Duration
+	lease      time.Duration
+	stopStatus string
+
+	mu        sync.Mutex
+	instances map[string]eurekaInstance
+}
+
+func (e *Eureka) ID() string {
+	return eurekaID
+}
+
+func (e *Eureka) Ping() error {
+	_, err := e.do(http.MethodGet, "/apps", nil)
+	return err
+}
+
+func (e *Eureka) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	for _, instance := range service.Instances() {
+		app := strings.ToUpper(instance.Name)
+		payload := eurekaInstance{
+			InstanceID:       instance.ID,
+			HostName:         instance.IP,
+			App:              app,
+			IPAddr:           instance.IP,
+			VIPAddress:       instance.Name,
+			SecureVIPAddress: instance.Name,
+			Status:           eurekaStatusUp,
+			Port:             eurekaPort{Port: instance.Port, Enabled: "true"},
+			SecurePort:       eurekaPort{Port: 443, Enabled: "false"},
+			DataCenterInfo: eurekaDataCenterInfo{
+				Class: "com.netflix.appinfo.InstanceInfo$DefaultDataCenterInfo",
+				Name:  "MyOwn",
+			},
+			LeaseInfo: eurekaLeaseInfo{
+				RenewalIntervalInSecs: int(e.interval.Seconds()),
+				DurationInSecs:        int(e.lease.Seconds()),
+			},
+			Metadata: service.Attributes(),
+		}
+
+		err := e.register(payload)
+		if err != nil {
+			return err
+		}
+
+		e.mu.Lock()
+		e.instances[instancePath(app, instance.ID)] = payload
+		e.mu.Unlock()
+	}
+
+	return nil
+}
+
+func (e *Eureka) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	for _, instance := range service.Instances() {
+		p := instancePath(strings.ToUpper(instance.Name), instance.ID)
+
+		e.mu.Lock()
+		delete(e.instances, p)
+		e.mu.Unlock()
+
+		_, err := e.do(http.MethodPut, p+"/status?value="+e.stopStatus, nil)
+		if err != nil && !errors.Is(err, ErrEurekaNotFound) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (e *Eureka) Services() ([]*service.RegisteredService, error) {
+	rv := []*service.RegisteredService{}
+	body, err := e.do(http.MethodGet, "/apps", nil)
+	if err != nil {
+		return rv, err
+	}
+
+	var apps eurekaApplications
+	if err := json.Unmarshal(body, &apps); err != nil {
+		return rv, fmt.Errorf("error decoding eureka applications: %w", err)
+	}
+
+	for _, app := range apps.Applications.Application {
+		for _, instance := range app.Instance {
+			rv = append(rv, &service.RegisteredService{
+				ID:         instance.InstanceID,
+				Name:       instance.VIPAddress,
+				IP:         instance.IPAddr,
+				Port:       instance.Port.Port,
+				Attributes: instance.Metadata,
+			})
+		}
+	}
+
+	return rv, nil
+}
+
+// heartbeat renews the lease of every instance, re-registering the ones Eureka forgot about.
+func (e *Eureka) heartbeat() {
+	e.mu.Lock()
+	instances := map[string]eurekaInstance{}
+	for p, instance := range e.instances {
+		instances[p] = instance
+	}
+	e.mu.Unlock()
+
+	for p, instance := range instances {
+		_, err := e.do(http.MethodPut, p, nil)
+		if errors.Is(err, ErrEurekaNotFound) {
+			err = e.register(instance)
+		}
+
+		if err != nil {
+			log.Println(fmt.Errorf("eureka: heartbeat %s: %w", instance.InstanceID, err))
+		}
+	}
+}
+
+func (e *Eureka) register(instance eurekaInstance) error {
+	body, err := json.Marshal(map[string]eurekaInstance{"instance": instance})
+	if err != nil {
+		return err
+	}
+
+	_, err = e.do(http.MethodPost, "/apps/"+url.PathEscape(instance.App), body)
+	return err
+}
+
+// do sends the request to each configured server in turn, until one of them answers.
+func (e *Eureka) do(method, path string, body []byte) ([]byte, error) {
+	err := ErrEurekaUnavailable
+	for _, server := range e.servers {
+		req, rerr := http.NewRequest(method, server+path, bytes.NewReader(body))
+		if rerr != nil {
+			return nil, rerr
+		}
+
+		req.Header.Set("Accept", "application/json")
+		if body != nil {
+			req.Header.Set("Content-Type", "application/json")
+		}
+
+		resp, rerr := e.client.Do(req)
+		if rerr != nil {
+			err = fmt.Errorf("%w: %s", ErrEurekaUnavailable, rerr)
+			continue
+		}
+
+		data, rerr := io.ReadAll(resp.Body)
+		resp.Body.Close()
+
+		switch {
+		case resp.StatusCode == http.StatusNotFound:
+			return nil, fmt.Errorf("%w: %s %s", ErrEurekaNotFound, method, path)
+		case resp.StatusCode >= 500:
+			err = fmt.Errorf("%w: %s answered %s", ErrEurekaUnavailable, server, resp.Status)
+			continue
+		case resp.StatusCode >= 300:
+			return nil, fmt.Errorf("eureka: %s %s: %s", method, path, resp.Status)
+		}
+
+		return data, rerr
+	}
+
+	return nil, err
+}
+
+func instancePath(app, instanceID string) string {
+	return "/apps/" + url.PathEscape(app) + "/" + url.PathEscape(instanceID)
+}
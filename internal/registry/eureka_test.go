@@ -0,0 +1,162 @@
+package registry
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeEurekaServer is a minimal stand-in for the Eureka REST API.
+type fakeEurekaServer struct {
+	mu         sync.Mutex
+	instances  map[string]eurekaInstance
+	heartbeats int
+}
+
+func (f *fakeEurekaServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	parts := strings.Split(strings.Trim(strings.TrimPrefix(r.URL.Path, "/eureka/apps"), "/"), "/")
+	switch {
+	case r.Method == http.MethodGet && parts[0] == "":
+		apps := eurekaApplications{}
+		byApp := map[string][]eurekaInstance{}
+		for _, instance := range f.instances {
+			byApp[instance.App] = append(byApp[instance.App], instance)
+		}
+
+		for name, instances := range byApp {
+			apps.Applications.Application = append(apps.Applications.Application, struct {
+				Name     string           `json:"name"`
+				Instance []eurekaInstance `json:"instance"`
+			}{Name: name, Instance: instances})
+		}
+
+		_ = json.NewEncoder(w).Encode(apps)
+	case r.Method == http.MethodPost && len(parts) == 1:
+		var body map[string]eurekaInstance
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+
+		f.instances[parts[0]+"/"+body["instance"].InstanceID] = body["instance"]
+		w.WriteHeader(http.StatusNoContent)
+	case r.Method == http.MethodPut && len(parts) == 2:
+		if _, ok := f.instances[parts[0]+"/"+parts[1]]; !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		f.heartbeats++
+	case r.Method == http.MethodPut && len(parts) == 3 && parts[2] == "status":
+		instance, ok := f.instances[parts[0]+"/"+parts[1]]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+
+		instance.Status = r.URL.Query().Get("value")
+		f.instances[parts[0]+"/"+parts[1]] = instance
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+func (f *fakeEurekaServer) instance(key string) (eurekaInstance, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	instance, ok := f.instances[key]
+	return instance, ok
+}
+
+func TestEurekaRegister(t *testing.T) {
+	fake := &fakeEurekaServer{instances: map[string]eurekaInstance{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := newEureka([]string{server.URL + "/eureka/"}, server.Client())
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.attributes": "region:eu-west-1",
+	})
+
+	assert.NoError(t, e.Ping())
+	assert.NoError(t, e.Register(srv))
+
+	instance, ok := fake.instance("WEB/web:tcp:80:host")
+	assert.True(t, ok)
+	assert.Equal(t, eurekaStatusUp, instance.Status)
+	assert.Equal(t, "10.0.0.2", instance.IPAddr)
+	assert.Equal(t, 80, instance.Port.Port)
+	assert.Equal(t, map[string]string{"region": "eu-west-1"}, instance.Metadata)
+
+	services, err := e.Services()
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, "web:tcp:80:host", services[0].ID)
+	assert.Equal(t, "web", services[0].Name)
+	assert.Equal(t, 80, services[0].Port)
+
+	e.heartbeat()
+	assert.Equal(t, 1, fake.heartbeats)
+
+	assert.NoError(t, e.Unregister(srv))
+	instance, _ = fake.instance("WEB/web:tcp:80:host")
+	assert.Equal(t, eurekaStatusDown, instance.Status)
+
+	// stopped instances are not kept alive anymore
+	e.heartbeat()
+	assert.Equal(t, 1, fake.heartbeats)
+}
+
+func TestEurekaHeartbeatReregisters(t *testing.T) {
+	fake := &fakeEurekaServer{instances: map[string]eurekaInstance{}}
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := newEureka([]string{server.URL + "/eureka"}, server.Client())
+	e.stopStatus = eurekaStatusOutOfService
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+	assert.NoError(t, e.Register(srv))
+
+	// eureka evicted the instance
+	fake.mu.Lock()
+	fake.instances = map[string]eurekaInstance{}
+	fake.mu.Unlock()
+
+	e.heartbeat()
+	_, ok := fake.instance("WEB/web:tcp:80:host")
+	assert.True(t, ok)
+
+	assert.NoError(t, e.Unregister(srv))
+	instance, _ := fake.instance("WEB/web:tcp:80:host")
+	assert.Equal(t, eurekaStatusOutOfService, instance.Status)
+}
+
+func TestEurekaFailover(t *testing.T) {
+	down := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer down.Close()
+
+	fake := &fakeEurekaServer{instances: map[string]eurekaInstance{}}
+	up := httptest.NewServer(fake)
+	defer up.Close()
+
+	e := newEureka([]string{down.URL + "/eureka", up.URL + "/eureka"}, up.Client())
+	assert.NoError(t, e.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+
+	_, ok := fake.instance("WEB/web:tcp:80:host")
+	assert.True(t, ok)
+
+	e = newEureka([]string{down.URL + "/eureka"}, down.Client())
+	assert.ErrorIs(t, e.Ping(), ErrEurekaUnavailable)
+}
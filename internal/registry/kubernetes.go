@@ -0,0 +1,386 @@
+package registry
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/tools/clientcmd"
+)
+
+const kubernetesID = "kubernetes"
+
+const (
+	envKubernetesNamespace = "CLERK_KUBERNETES_NAMESPACE"
+	envKubernetesNode      = "CLERK_KUBERNETES_NODE"
+
+	defaultKubernetesNamespace = "default"
+
+	kubernetesManagedBy  = "clerk.njasm.github.com"
+	kubernetesNodeLabel  = "clerk.njasm.github.com/node"
+	kubernetesOwnerLabel = "clerk.njasm.github.com/service"
+)
+
+func NewKubernetes() (clerk.Registry, error) {
+	// KUBECONFIG when set, the in-cluster service account otherwise
+	config, err := clientcmd.BuildConfigFromFlags("", os.Getenv("KUBECONFIG"))
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes registry: %w", err)
+	}
+
+	client, err := kubernetes.NewForConfig(config)
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes registry: %w", err)
+	}
+
+	node, err := kubernetesNode()
+	if err != nil {
+		return nil, fmt.Errorf("error creating kubernetes registry: %w", err)
+	}
+
+	return newKubernetes(client, utils.EnvOrDefault(envKubernetesNamespace, defaultKubernetesNamespace), node), nil
+}
+
+// kubernetesNode names the slices this clerk owns. It has to outlive clerk restarts, or the
+// slices of the previous clerk are never cleaned up, so it is CLERK_KUBERNETES_NODE or
+// else the node name, never the hostname of the clerk container.
+func kubernetesNode() (string, error) {
+	node := strings.TrimSpace(utils.EnvOrDefault(envKubernetesNode, ""))
+	if node == "" {
+		name, err := service.NodeName()
+		if err != nil {
+			return "", fmt.Errorf("%w, or %s", err, envKubernetesNode)
+		}
+
+		node = name
+	}
+
+	if dnsLabel(node) == "" {
+		return "", fmt.Errorf("invalid node name %q, set %s", node, envKubernetesNode)
+	}
+
+	return node, nil
+}
+
+func newKubernetes(client kubernetes.Interface, namespace, node string) *Kubernetes {
+	return &Kubernetes{
+		client:    client,
+		namespace: namespace,
+		node:      dnsLabel(node),
+		instances: instanceSet{},
+	}
+}
+
+// Kubernetes mirrors registered instances into EndpointSlices named after their service,
+// so a selector-less Kubernetes Service with the same name routes to the containers.
+// Slices are labelled with the clerk node that owns them, and each clerk only updates
+// and garbage collects its own slices. The slices of a previous run are kept until the
+// running containers are registered again, see Collect.
+type Kubernetes struct {
+	client    kubernetes.Interface
+	namespace string
+	node      string
+
+	mu        sync.Mutex
+	instances instanceSet
+}
+
+func (k *Kubernetes) ID() string {
+	return kubernetesID
+}
+
+func (k *Kubernetes) Ping() error {
+	_, err := k.client.Discovery().ServerVersion()
+	return err
+}
+
+func (k *Kubernetes) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.instances.add(service)
+	return k.syncAll(context.Background(), service)
+}
+
+func (k *Kubernetes) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	k.instances.remove(service)
+	return k.syncAll(context.Background(), service)
+}
+
+// Services returns the instances of this clerk that are present in one of its slices.
+func (k *Kubernetes) Services() ([]*service.RegisteredService, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	rv := []*service.RegisteredService{}
+	slices, err := k.list(context.Background(), labels.Set{kubernetesNodeLabel: k.node})
+	if err != nil {
+		return rv, err
+	}
+
+	published := map[string]bool{}
+	for _, slice := range slices {
+		for _, port := range slice.Ports {
+			for _, endpoint := range slice.Endpoints {
+				for _, address := range endpoint.Addresses {
+					published[endpointKey(slice.Labels[kubernetesOwnerLabel], address, port)] = true
+				}
+			}
+		}
+	}
+
+	for _, instance := range k.instances.sorted() {
+		port := discoveryv1.EndpointPort{Port: int32Ptr(instance.Port), Protocol: protocolPtr(instance.Proto)}
+		if published[endpointKey(sliceOwner(instance.Name), instance.IP, port)] {
+			rv = append(rv, instance)
+		}
+	}
+
+	return rv, nil
+}
+
+// syncAll syncs the slices of every service name the instances of srv are registered under.
+func (k *Kubernetes) syncAll(ctx context.Context, srv *service.Service) error {
+	synced := map[string]bool{}
+	for _, instance := range srv.Instances() {
+		if synced[instance.Name] {
+			continue
+		}
+
+		synced[instance.Name] = true
+		if err := k.sync(ctx, instance.Name); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// sync creates, updates and deletes the slices of service name to match the registered instances.
+func (k *Kubernetes) sync(ctx context.Context, name string) error {
+	desired := k.desired(name)
+	existing, err := k.list(ctx, labels.Set{kubernetesNodeLabel: k.node, kubernetesOwnerLabel: sliceOwner(name)})
+	if err != nil {
+		return err
+	}
+
+	slices := k.client.DiscoveryV1().EndpointSlices(k.namespace)
+	for _, current := range existing {
+		slice, ok := desired[current.Name]
+		if !ok {
+			err := slices.Delete(ctx, current.Name, metav1.DeleteOptions{})
+			if err != nil && !apierrors.IsNotFound(err) {
+				return err
+			}
+
+			continue
+		}
+
+		delete(desired, current.Name)
+		slice.ResourceVersion = current.ResourceVersion
+		if _, err := slices.Update(ctx, slice, metav1.UpdateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	for _, slice := range desired {
+		if _, err := slices.Create(ctx, slice, metav1.CreateOptions{}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Collect deletes the slices of the services that aren't registered anymore, like the ones
+// of the containers that stopped while clerk wasn't running.
+func (k *Kubernetes) Collect() error {
+	return k.collect(context.Background())
+}
+
+// collect deletes every slice owned by this clerk that has no registered instance.
+func (k *Kubernetes) collect(ctx context.Context) error {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+
+	slices, err := k.list(ctx, labels.Set{kubernetesNodeLabel: k.node})
+	if err != nil {
+		return err
+	}
+
+	live := map[string]bool{}
+	for _, instance := range k.instances {
+		live[sliceOwner(instance.Name)] = true
+	}
+
+	for _, slice := range slices {
+		if live[slice.Labels[kubernetesOwnerLabel]] {
+			continue
+		}
+
+		err := k.client.DiscoveryV1().EndpointSlices(k.namespace).Delete(ctx, slice.Name, metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// desired builds the slices of service name. Every endpoint of a slice exposes all the slice
+// ports, so instances are grouped by address, then addresses sharing the same ports and
+// address type go into the same slice.
+func (k *Kubernetes) desired(name string) map[string]*discoveryv1.EndpointSlice {
+	ports := map[string][]discoveryv1.EndpointPort{}
+	for _, instance := range k.instances.sorted() {
+		if instance.Name != name || net.ParseIP(instance.IP) == nil {
+			continue
+		}
+
+		ports[instance.IP] = append(ports[instance.IP], discoveryv1.EndpointPort{
+			Port:     int32Ptr(instance.Port),
+			Protocol: protocolPtr(instance.Proto),
+		})
+	}
+
+	rv := map[string]*discoveryv1.EndpointSlice{}
+	for ip, endpointPorts := range ports {
+		addressType := discoveryv1.AddressTypeIPv4
+		if net.ParseIP(ip).To4() == nil {
+			addressType = discoveryv1.AddressTypeIPv6
+		}
+
+		// named, so a Service port can target the port of any slice by name
+		for i := range endpointPorts {
+			portName := fmt.Sprintf("%s-%d", strings.ToLower(string(*endpointPorts[i].Protocol)), *endpointPorts[i].Port)
+			endpointPorts[i].Name = &portName
+		}
+
+		sort.Slice(endpointPorts, func(i, j int) bool {
+			if *endpointPorts[i].Port == *endpointPorts[j].Port {
+				return *endpointPorts[i].Protocol < *endpointPorts[j].Protocol
+			}
+
+			return *endpointPorts[i].Port < *endpointPorts[j].Port
+		})
+		signature := string(addressType)
+		for _, port := range endpointPorts {
+			signature += fmt.Sprintf("/%s:%d", *port.Protocol, *port.Port)
+		}
+
+		sliceName := k.sliceName(name, signature)
+		slice, ok := rv[sliceName]
+		if !ok {
+			slice = &discoveryv1.EndpointSlice{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      sliceName,
+					Namespace: k.namespace,
+					Labels: map[string]string{
+						discoveryv1.LabelServiceName: dnsLabel(name),
+						discoveryv1.LabelManagedBy:   kubernetesManagedBy,
+						kubernetesNodeLabel:          k.node,
+						kubernetesOwnerLabel:         sliceOwner(name),
+					},
+				},
+				AddressType: addressType,
+				Ports:       endpointPorts,
+			}
+
+			rv[sliceName] = slice
+		}
+
+		ready := true
+		slice.Endpoints = append(slice.Endpoints, discoveryv1.Endpoint{
+			Addresses:  []string{ip},
+			Conditions: discoveryv1.EndpointConditions{Ready: &ready},
+		})
+	}
+
+	for _, slice := range rv {
+		sort.Slice(slice.Endpoints, func(i, j int) bool { return slice.Endpoints[i].Addresses[0] < slice.Endpoints[j].Addresses[0] })
+	}
+
+	return rv
+}
+
+func (k *Kubernetes) list(ctx context.Context, set labels.Set) ([]discoveryv1.EndpointSlice, error) {
+	list, err := k.client.DiscoveryV1().EndpointSlices(k.namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: labels.SelectorFromSet(set).String(),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return list.Items, nil
+}
+
+// sliceName is unique per service, clerk node and port signature, and a valid object name.
+func (k *Kubernetes) sliceName(name, signature string) string {
+	sum := sha256.Sum256([]byte(name + "/" + k.node + "/" + signature))
+	prefix := dnsLabel(name + "-" + k.node)
+	if len(prefix) > 50 {
+		prefix = strings.TrimRight(prefix[:50], "-")
+	}
+
+	return prefix + "-" + hex.EncodeToString(sum[:])[:10]
+}
+
+// sliceOwner is a label value that identifies service name, which may not be a valid label value itself.
+func sliceOwner(name string) string {
+	sum := sha256.Sum256([]byte(name))
+	return hex.EncodeToString(sum[:])[:40]
+}
+
+func endpointKey(owner, address string, port discoveryv1.EndpointPort) string {
+	key := owner + "/" + address
+	if port.Protocol != nil {
+		key += "/" + string(*port.Protocol)
+	}
+
+	if port.Port != nil {
+		key += ":" + strconv.Itoa(int(*port.Port))
+	}
+
+	return key
+}
+
+func int32Ptr(value int) *int32 {
+	rv := int32(value)
+	return &rv
+}
+
+func protocolPtr(proto string) *corev1.Protocol {
+	rv := corev1.Protocol(strings.ToUpper(proto))
+	if rv == "" {
+		rv = corev1.ProtocolTCP
+	}
+
+	return &rv
+}
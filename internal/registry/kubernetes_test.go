@@ -0,0 +1,117 @@
+package registry
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func listSlices(t *testing.T, client *fake.Clientset) []discoveryv1.EndpointSlice {
+	list, err := client.DiscoveryV1().EndpointSlices("clerk").List(context.Background(), metav1.ListOptions{})
+	assert.NoError(t, err)
+
+	return list.Items
+}
+
+func TestKubernetesEndpointSlices(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	k := newKubernetes(client, "clerk", "Docker-Host-1")
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":  "web",
+		"com.github.njasm.clerk.ports": "80/tcp,443/tcp",
+	})
+
+	assert.NoError(t, k.Register(srv))
+
+	slices := listSlices(t, client)
+	assert.Len(t, slices, 1)
+	slice := slices[0]
+	assert.Equal(t, "web", slice.Labels[discoveryv1.LabelServiceName])
+	assert.Equal(t, kubernetesManagedBy, slice.Labels[discoveryv1.LabelManagedBy])
+	assert.Equal(t, "docker-host-1", slice.Labels[kubernetesNodeLabel])
+	assert.Equal(t, discoveryv1.AddressTypeIPv4, slice.AddressType)
+	assert.Equal(t, []string{"10.0.0.2"}, slice.Endpoints[0].Addresses)
+	assert.Len(t, slice.Ports, 2)
+	assert.Equal(t, "tcp-80", *slice.Ports[0].Name)
+	assert.Equal(t, int32(443), *slice.Ports[1].Port)
+
+	services, err := k.Services()
+	assert.NoError(t, err)
+	assert.Len(t, services, 2)
+
+	// registering again updates the same slice
+	assert.NoError(t, k.Register(srv))
+	assert.Len(t, listSlices(t, client), 1)
+
+	assert.NoError(t, k.Unregister(srv))
+	assert.Empty(t, listSlices(t, client))
+}
+
+func TestKubernetesServicesNotPublished(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	k := newKubernetes(client, "clerk", "host")
+	assert.NoError(t, k.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+
+	// someone deleted the slice, synchronise must register the instance again
+	slice := listSlices(t, client)[0]
+	assert.NoError(t, client.DiscoveryV1().EndpointSlices("clerk").Delete(context.Background(), slice.Name, metav1.DeleteOptions{}))
+
+	services, err := k.Services()
+	assert.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestKubernetesCollectsOnlyOwnSlices(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	other := newKubernetes(client, "clerk", "other-host")
+	assert.NoError(t, other.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+
+	k := newKubernetes(client, "clerk", "host")
+	assert.NoError(t, k.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+	assert.Len(t, listSlices(t, client), 2)
+
+	// clerk restarted on host, the container stopped in the meantime
+	k = newKubernetes(client, "clerk", "host")
+	assert.NoError(t, k.Collect())
+
+	slices := listSlices(t, client)
+	assert.Len(t, slices, 1)
+	assert.Equal(t, "other-host", slices[0].Labels[kubernetesNodeLabel])
+}
+
+func TestKubernetesKeepsSlicesOfRunningContainers(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+	assert.NoError(t, newKubernetes(client, "clerk", "host").Register(srv))
+	before := listSlices(t, client)
+
+	// clerk restarted, the running container is registered again before collecting
+	k := newKubernetes(client, "clerk", "host")
+	assert.NoError(t, k.Register(srv))
+	assert.NoError(t, k.Collect())
+
+	after := listSlices(t, client)
+	assert.Len(t, after, 1)
+	assert.Equal(t, before[0].Name, after[0].Name)
+	assert.Equal(t, "tcp-80", *after[0].Ports[0].Name)
+}
+
+func TestKubernetesNode(t *testing.T) {
+	t.Setenv("CLERK_NODE_NAME", "node1")
+	node, err := kubernetesNode()
+	assert.NoError(t, err)
+	assert.Equal(t, "node1", node)
+
+	t.Setenv(envKubernetesNode, "worker-1")
+	node, err = kubernetesNode()
+	assert.NoError(t, err)
+	assert.Equal(t, "worker-1", node)
+
+	t.Setenv(envKubernetesNode, "!!!")
+	_, err = kubernetesNode()
+	assert.Error(t, err)
+}
@@ -0,0 +1,257 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+	"gopkg.in/yaml.v3"
+)
+
+const proxyFileID = "proxyfile"
+
+const (
+	envProxyFileTraefikPath = "CLERK_PROXYFILE_TRAEFIK_PATH"
+	envProxyFileEnvoyPath   = "CLERK_PROXYFILE_ENVOY_PATH"
+
+	envoyClusterLoadAssignmentType = "type.googleapis.com/envoy.config.endpoint.v3.ClusterLoadAssignment"
+)
+
+var ErrNoProxyFile = errors.New("no proxy file configured")
+
+type traefikServer struct {
+	URL     string `yaml:"url,omitempty"`
+	Address string `yaml:"address,omitempty"`
+}
+
+type traefikLoadBalancer struct {
+	Servers []traefikServer `yaml:"servers"`
+}
+
+type traefikService struct {
+	LoadBalancer traefikLoadBalancer `yaml:"loadBalancer"`
+}
+
+type traefikServices struct {
+	Services map[string]*traefikService `yaml:"services"`
+}
+
+// traefikConfig is a Traefik file provider dynamic configuration, tcp instances are
+// published as http services, udp instances as udp services and sctp ones are skipped.
+type traefikConfig struct {
+	HTTP *traefikServices `yaml:"http,omitempty"`
+	UDP  *traefikServices `yaml:"udp,omitempty"`
+}
+
+type envoySocketAddress struct {
+	Address   string `json:"address"`
+	PortValue int    `json:"port_value"`
+	Protocol  string `json:"protocol"`
+}
+
+type envoyLbEndpoint struct {
+	Endpoint struct {
+		Address struct {
+			SocketAddress envoySocketAddress `json:"socket_address"`
+		} `json:"address"`
+	} `json:"endpoint"`
+}
+
+type envoyLocalityLbEndpoints struct {
+	LbEndpoints []envoyLbEndpoint `json:"lb_endpoints"`
+}
+
+type envoyClusterLoadAssignment struct {
+	Type        string                     `json:"@type"`
+	ClusterName string                     `json:"cluster_name"`
+	Endpoints   []envoyLocalityLbEndpoints `json:"endpoints"`
+}
+
+// envoyDiscoveryResponse is the EDS snapshot read by an Envoy `path_config_source`.
+type envoyDiscoveryResponse struct {
+	VersionInfo string                       `json:"version_info"`
+	Resources   []envoyClusterLoadAssignment `json:"resources"`
+}
+
+func NewProxyFile() (clerk.Registry, error) {
+	p := newProxyFile(utils.EnvOrDefault(envProxyFileTraefikPath, ""), utils.EnvOrDefault(envProxyFileEnvoyPath, ""))
+	if p.traefikPath == "" && p.envoyPath == "" {
+		return nil, fmt.Errorf("error creating proxy file registry: %w: set %s and/or %s", ErrNoProxyFile, envProxyFileTraefikPath, envProxyFileEnvoyPath)
+	}
+
+	// start from empty files, so stale backends of a previous run aren't served
+	return p, p.write()
+}
+
+func newProxyFile(traefikPath, envoyPath string) *ProxyFile {
+	return &ProxyFile{
+		traefikPath: traefikPath,
+		envoyPath:   envoyPath,
+		instances:   instanceSet{},
+	}
+}
+
+// ProxyFile writes a Traefik file provider configuration and/or an Envoy EDS snapshot
+// with every registered instance grouped by service name. Both files are rewritten
+// atomically on every change, so local proxies pick them up without a registry.
+type ProxyFile struct {
+	traefikPath string
+	envoyPath   string
+
+	mu        sync.Mutex
+	version   uint64
+	instances instanceSet
+}
+
+func (p *ProxyFile) ID() string {
+	return proxyFileID
+}
+
+func (p *ProxyFile) Ping() error {
+	return nil
+}
+
+func (p *ProxyFile) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	diagnoseUnproxied(proxyFileID, service)
+	p.instances.add(service)
+	return p.write()
+}
+
+func (p *ProxyFile) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.instances.remove(service)
+	return p.write()
+}
+
+func (p *ProxyFile) Services() ([]*service.RegisteredService, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	return p.instances.sorted(), nil
+}
+
+func (p *ProxyFile) write() error {
+	p.version++
+	if p.traefikPath != "" {
+		data, err := yaml.Marshal(p.traefik())
+		if err != nil {
+			return err
+		}
+
+		if err := utils.WriteFileAtomic(p.traefikPath, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	if p.envoyPath != "" {
+		data, err := json.MarshalIndent(p.envoy(), "", "  ")
+		if err != nil {
+			return err
+		}
+
+		if err := utils.WriteFileAtomic(p.envoyPath, data, 0644); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (p *ProxyFile) traefik() traefikConfig {
+	config := traefikConfig{}
+	for _, instance := range p.instances.sorted() {
+		if !proxied(instance) {
+			continue
+		}
+
+		address := net.JoinHostPort(instance.IP, strconv.Itoa(instance.Port))
+		if strings.EqualFold(instance.Proto, "udp") {
+			if config.UDP == nil {
+				config.UDP = &traefikServices{Services: map[string]*traefikService{}}
+			}
+
+			lb := traefikLoadBalancerFor(config.UDP, instance.Name)
+			lb.Servers = append(lb.Servers, traefikServer{Address: address})
+			continue
+		}
+
+		if config.HTTP == nil {
+			config.HTTP = &traefikServices{Services: map[string]*traefikService{}}
+		}
+
+		lb := traefikLoadBalancerFor(config.HTTP, instance.Name)
+		lb.Servers = append(lb.Servers, traefikServer{URL: "http://" + address})
+	}
+
+	return config
+}
+
+func traefikLoadBalancerFor(services *traefikServices, name string) *traefikLoadBalancer {
+	if _, ok := services.Services[name]; !ok {
+		services.Services[name] = &traefikService{LoadBalancer: traefikLoadBalancer{Servers: []traefikServer{}}}
+	}
+
+	return &services.Services[name].LoadBalancer
+}
+
+func (p *ProxyFile) envoy() envoyDiscoveryResponse {
+	response := envoyDiscoveryResponse{
+		VersionInfo: strconv.FormatUint(p.version, 10),
+		Resources:   []envoyClusterLoadAssignment{},
+	}
+
+	clusters := map[string]int{}
+	for _, instance := range p.instances.sorted() {
+		if !proxied(instance) {
+			continue
+		}
+
+		i, ok := clusters[instance.Name]
+		if !ok {
+			i = len(response.Resources)
+			clusters[instance.Name] = i
+			response.Resources = append(response.Resources, envoyClusterLoadAssignment{
+				Type:        envoyClusterLoadAssignmentType,
+				ClusterName: instance.Name,
+				Endpoints:   []envoyLocalityLbEndpoints{{LbEndpoints: []envoyLbEndpoint{}}},
+			})
+		}
+
+		protocol := "TCP"
+		if strings.EqualFold(instance.Proto, "udp") {
+			protocol = "UDP"
+		}
+
+		var endpoint envoyLbEndpoint
+		endpoint.Endpoint.Address.SocketAddress = envoySocketAddress{
+			Address:   instance.IP,
+			PortValue: instance.Port,
+			Protocol:  protocol,
+		}
+
+		lb := &response.Resources[i].Endpoints[0]
+		lb.LbEndpoints = append(lb.LbEndpoints, endpoint)
+	}
+
+	return response
+}
@@ -0,0 +1,100 @@
+package registry
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProxyFile(t *testing.T) {
+	dir := t.TempDir()
+	p := newProxyFile(filepath.Join(dir, "traefik.yaml"), filepath.Join(dir, "eds.json"))
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":  "web",
+		"com.github.njasm.clerk.ports": "80/tcp,53/udp",
+	})
+
+	assert.NoError(t, p.Register(srv))
+
+	data, err := os.ReadFile(filepath.Join(dir, "traefik.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, `http:
+    services:
+        web:
+            loadBalancer:
+                servers:
+                    - url: http://10.0.0.2:80
+udp:
+    services:
+        web:
+            loadBalancer:
+                servers:
+                    - address: 10.0.0.2:53
+`, string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "eds.json"))
+	assert.NoError(t, err)
+
+	var eds envoyDiscoveryResponse
+	assert.NoError(t, json.Unmarshal(data, &eds))
+	assert.Equal(t, "1", eds.VersionInfo)
+	assert.Len(t, eds.Resources, 1)
+	assert.Equal(t, envoyClusterLoadAssignmentType, eds.Resources[0].Type)
+	assert.Equal(t, "web", eds.Resources[0].ClusterName)
+	assert.Len(t, eds.Resources[0].Endpoints[0].LbEndpoints, 2)
+	assert.Equal(t, envoySocketAddress{Address: "10.0.0.2", PortValue: 53, Protocol: "UDP"}, eds.Resources[0].Endpoints[0].LbEndpoints[1].Endpoint.Address.SocketAddress)
+
+	assert.NoError(t, p.Unregister(srv))
+
+	data, err = os.ReadFile(filepath.Join(dir, "traefik.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, "{}\n", string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "eds.json"))
+	assert.NoError(t, err)
+	assert.NoError(t, json.Unmarshal(data, &eds))
+	assert.Equal(t, "2", eds.VersionInfo)
+	assert.Empty(t, eds.Resources)
+}
+
+func TestNewProxyFileRequiresAPath(t *testing.T) {
+	_, err := NewProxyFile()
+	assert.ErrorIs(t, err, ErrNoProxyFile)
+}
+
+func TestProxyFileSkipsSCTP(t *testing.T) {
+	dir := t.TempDir()
+	p := newProxyFile(filepath.Join(dir, "traefik.yaml"), filepath.Join(dir, "eds.json"))
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":  "web",
+		"com.github.njasm.clerk.ports": "80/tcp,3868/sctp",
+	})
+
+	diagnostics := diagnoseUnproxied(proxyFileID, srv)
+	assert.Len(t, diagnostics, 1)
+	assert.Equal(t, "com.github.njasm.clerk.ports", diagnostics[0].Label)
+	assert.Contains(t, diagnostics[0].Message, "sctp port 3868 skipped by proxyfile")
+
+	assert.NoError(t, p.Register(srv))
+
+	data, err := os.ReadFile(filepath.Join(dir, "traefik.yaml"))
+	assert.NoError(t, err)
+	assert.Equal(t, `http:
+    services:
+        web:
+            loadBalancer:
+                servers:
+                    - url: http://10.0.0.2:80
+`, string(data))
+
+	data, err = os.ReadFile(filepath.Join(dir, "eds.json"))
+	assert.NoError(t, err)
+
+	var eds envoyDiscoveryResponse
+	assert.NoError(t, json.Unmarshal(data, &eds))
+	assert.Len(t, eds.Resources[0].Endpoints[0].LbEndpoints, 1)
+	assert.Equal(t, "TCP", eds.Resources[0].Endpoints[0].LbEndpoints[0].Endpoint.Address.SocketAddress.Protocol)
+}
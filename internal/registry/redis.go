@@ -0,0 +1,266 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+	"github.com/redis/go-redis/v9"
+)
+
+const redisID = "redis"
+
+const (
+	envRedisURL    = "CLERK_REDIS_URL"
+	envRedisPrefix = "CLERK_REDIS_PREFIX"
+	envRedisTTL    = "CLERK_REDIS_TTL"
+
+	defaultRedisURL    = "redis://127.0.0.1:6379/0"
+	defaultRedisPrefix = "clerk"
+	defaultRedisTTL    = "30s"
+
+	redisEventRegister   = "register"
+	redisEventUnregister = "unregister"
+)
+
+// redisEvent is published on `<prefix>:events` every time an instance is added or removed.
+type redisEvent struct {
+	Event string `json:"event"`
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	IP    string `json:"ip"`
+	Port  int    `json:"port"`
+}
+
+func NewRedis() (clerk.Registry, error) {
+	options, err := redis.ParseURL(utils.EnvOrDefault(envRedisURL, defaultRedisURL))
+	if err != nil {
+		return nil, fmt.Errorf("error creating redis registry: %w", err)
+	}
+
+	ttl, err := time.ParseDuration(utils.EnvOrDefault(envRedisTTL, defaultRedisTTL))
+	if err != nil {
+		return nil, fmt.Errorf("error creating redis registry: %w", err)
+	}
+
+	r := newRedis(redis.NewClient(options), utils.EnvOrDefault(envRedisPrefix, defaultRedisPrefix), ttl)
+	go func(r *Redis, ticker *time.Ticker) {
+		for range ticker.C {
+			r.refresh()
+		}
+	}(r, time.NewTicker(ttl/3))
+
+	return r, nil
+}
+
+func newRedis(client *redis.Client, prefix string, ttl time.Duration) *Redis {
+	return &Redis{
+		client:    client,
+		prefix:    strings.TrimSuffix(prefix, ":"),
+		ttl:       ttl,
+		instances: map[string]map[string]interface{}{},
+	}
+}
+
+// Redis stores every instance as a hash at `<prefix>:instance:<id>` and its ID in the
+// `<prefix>:service:<name>` sorted set, scored by when it expires in unix milliseconds.
+// Both expire unless clerk keeps refreshing their TTL, the IDs expired in the set are
+// removed on every write, and every change is published on the `<prefix>:events` channel.
+type Redis struct {
+	client *redis.Client
+	prefix string
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	instances map[string]map[string]interface{}
+}
+
+func (r *Redis) ID() string {
+	return redisID
+}
+
+func (r *Redis) Ping() error {
+	return r.client.Ping(context.Background()).Err()
+}
+
+func (r *Redis) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	attributes, err := json.Marshal(service.Attributes())
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, instance := range service.Instances() {
+		fields := map[string]interface{}{
+			"id":         instance.ID,
+			"name":       instance.Name,
+			"ip":         instance.IP,
+			"port":       instance.Port,
+			"proto":      instance.Proto,
+			"tags":       strings.Join(service.InstanceTags(instance), ","),
+			"attributes": string(attributes),
+		}
+
+		err := r.write(context.Background(), fields)
+		if err != nil {
+			return err
+		}
+
+		r.instances[instance.ID] = fields
+		r.publish(redisEventRegister, instance.Name, instance)
+	}
+
+	return nil
+}
+
+func (r *Redis) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx := context.Background()
+	for _, instance := range service.Instances() {
+		delete(r.instances, instance.ID)
+
+		_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+			pipe.Del(ctx, r.instanceKey(instance.ID))
+			pipe.ZRem(ctx, r.serviceKey(instance.Name), instance.ID)
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+
+		r.publish(redisEventUnregister, instance.Name, instance)
+	}
+
+	return nil
+}
+
+func (r *Redis) Services() ([]*service.RegisteredService, error) {
+	rv := []*service.RegisteredService{}
+	ctx := context.Background()
+	iter := r.client.Scan(ctx, 0, r.instanceKey("*"), 100).Iterator()
+	for iter.Next(ctx) {
+		fields, err := r.client.HGetAll(ctx, iter.Val()).Result()
+		if err != nil {
+			return rv, err
+		}
+
+		// expired in between the scan and the read
+		if len(fields) == 0 {
+			continue
+		}
+
+		port, _ := strconv.Atoi(fields["port"])
+		s := &service.RegisteredService{
+			ID:    fields["id"],
+			Name:  fields["name"],
+			IP:    fields["ip"],
+			Port:  port,
+			Proto: fields["proto"],
+			Tags:  []string{},
+		}
+
+		if fields["tags"] != "" {
+			s.Tags = strings.Split(fields["tags"], ",")
+		}
+
+		if err := json.Unmarshal([]byte(fields["attributes"]), &s.Attributes); err != nil {
+			log.Println(fmt.Errorf("redis: invalid attributes in %s: %w", iter.Val(), err))
+		}
+
+		rv = append(rv, s)
+	}
+
+	return rv, iter.Err()
+}
+
+// refresh extends the TTL of every instance registered by this clerk, re-writing the
+// ones that expired in the meantime.
+func (r *Redis) refresh() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ctx := context.Background()
+	for id, fields := range r.instances {
+		ok, err := r.client.Expire(ctx, r.instanceKey(id), r.ttl).Result()
+		if err == nil && ok {
+			_, err = r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				r.index(ctx, pipe, id, fields["name"].(string))
+				return nil
+			})
+		}
+
+		if err == nil && !ok {
+			err = r.write(ctx, fields)
+		}
+
+		if err != nil {
+			log.Println(fmt.Errorf("redis: refreshing %s: %w", id, err))
+		}
+	}
+}
+
+func (r *Redis) write(ctx context.Context, fields map[string]interface{}) error {
+	id, name := fields["id"].(string), fields["name"].(string)
+	_, err := r.client.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		pipe.HSet(ctx, r.instanceKey(id), fields)
+		pipe.Expire(ctx, r.instanceKey(id), r.ttl)
+		r.index(ctx, pipe, id, name)
+		return nil
+	})
+
+	return err
+}
+
+// index adds id to the set of its service until it expires, and removes the expired ones,
+// like the instances of a clerk that stopped.
+func (r *Redis) index(ctx context.Context, pipe redis.Pipeliner, id, name string) {
+	now := time.Now()
+	pipe.ZAdd(ctx, r.serviceKey(name), redis.Z{Score: float64(now.Add(r.ttl).UnixMilli()), Member: id})
+	pipe.ZRemRangeByScore(ctx, r.serviceKey(name), "-inf", strconv.FormatInt(now.UnixMilli(), 10))
+	pipe.Expire(ctx, r.serviceKey(name), r.ttl)
+}
+
+func (r *Redis) publish(event, name string, instance service.Instance) {
+	data, err := json.Marshal(redisEvent{
+		Event: event,
+		ID:    instance.ID,
+		Name:  name,
+		IP:    instance.IP,
+		Port:  instance.Port,
+	})
+	if err == nil {
+		err = r.client.Publish(context.Background(), r.prefix+":events", data).Err()
+	}
+
+	if err != nil {
+		log.Println(fmt.Errorf("redis: publishing %s of %s: %w", event, instance.ID, err))
+	}
+}
+
+func (r *Redis) instanceKey(id string) string {
+	return r.prefix + ":instance:" + id
+}
+
+func (r *Redis) serviceKey(name string) string {
+	return r.prefix + ":service:" + name
+}
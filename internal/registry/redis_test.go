@@ -0,0 +1,93 @@
+package registry
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedisRegister(t *testing.T) {
+	mr := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: mr.Addr()})
+	r := newRedis(client, "clerk:", 30*time.Second)
+
+	events := client.Subscribe(context.Background(), "clerk:events")
+	defer events.Close()
+	_, err := events.Receive(context.Background())
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.tags":       "primary,test",
+		"com.github.njasm.clerk.attributes": "region:eu-west-1",
+	})
+
+	assert.NoError(t, r.Ping())
+	assert.NoError(t, r.Register(srv))
+
+	assert.Equal(t, "10.0.0.2", mr.HGet("clerk:instance:web:tcp:80:host", "ip"))
+	assert.Equal(t, 30*time.Second, mr.TTL("clerk:instance:web:tcp:80:host"))
+	members, err := mr.ZMembers("clerk:service:web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web:tcp:80:host"}, members)
+
+	message, err := events.ReceiveMessage(context.Background())
+	assert.NoError(t, err)
+	var event redisEvent
+	assert.NoError(t, json.Unmarshal([]byte(message.Payload), &event))
+	assert.Equal(t, redisEvent{Event: redisEventRegister, ID: "web:tcp:80:host", Name: "web", IP: "10.0.0.2", Port: 80}, event)
+
+	services, err := r.Services()
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, "web:tcp:80:host", services[0].ID)
+	assert.Equal(t, 80, services[0].Port)
+	assert.Equal(t, []string{"primary", "test"}, services[0].Tags)
+	assert.Equal(t, map[string]string{"region": "eu-west-1"}, services[0].Attributes)
+
+	assert.NoError(t, r.Unregister(srv))
+	assert.False(t, mr.Exists("clerk:instance:web:tcp:80:host"))
+	assert.False(t, mr.Exists("clerk:service:web"))
+
+	message, err = events.ReceiveMessage(context.Background())
+	assert.NoError(t, err)
+	assert.Contains(t, message.Payload, `"event":"unregister"`)
+}
+
+func TestRedisRefresh(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "clerk", 30*time.Second)
+	assert.NoError(t, r.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+
+	mr.FastForward(20 * time.Second)
+	r.refresh()
+	assert.Equal(t, 30*time.Second, mr.TTL("clerk:instance:web:tcp:80:host"))
+
+	// keys expired, e.g. redis restarted or clerk was stalled
+	mr.FastForward(time.Minute)
+	assert.False(t, mr.Exists("clerk:instance:web:tcp:80:host"))
+
+	r.refresh()
+	assert.True(t, mr.Exists("clerk:instance:web:tcp:80:host"))
+	assert.True(t, mr.Exists("clerk:service:web"))
+}
+
+func TestRedisRefreshRemovesExpiredMembers(t *testing.T) {
+	mr := miniredis.RunT(t)
+	r := newRedis(redis.NewClient(&redis.Options{Addr: mr.Addr()}), "clerk", 30*time.Second)
+	assert.NoError(t, r.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+
+	// left by a clerk that stopped, its instance hash is gone
+	_, err := mr.ZAdd("clerk:service:web", float64(time.Now().Add(-time.Second).UnixMilli()), "web:tcp:80:other")
+	assert.NoError(t, err)
+
+	r.refresh()
+	members, err := mr.ZMembers("clerk:service:web")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"web:tcp:80:host"}, members)
+}
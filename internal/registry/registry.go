@@ -0,0 +1,130 @@
+package registry
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+)
+
+var ErrUnknownRegistry = errors.New("unknown registry")
+
+// New creates the registry identified by id. A comma separated list of ids
+// creates a Composite registry that forwards to each one of them.
+func New(id string) (clerk.Registry, error) {
+	ids := strings.Split(id, ",")
+	if len(ids) == 1 {
+		return newRegistry(id)
+	}
+
+	backends := []clerk.Registry{}
+	for _, id := range ids {
+		backend, err := newRegistry(id)
+		if err != nil {
+			return nil, err
+		}
+
+		backends = append(backends, backend)
+	}
+
+	return NewComposite(backends...)
+}
+
+func newRegistry(id string) (clerk.Registry, error) {
+	switch strings.ToLower(strings.TrimSpace(id)) {
+	case consulID:
+		return NewConsul()
+	case zookeeperID:
+		return NewZookeeper()
+	case eurekaID:
+		return NewEureka()
+	case dnsFileID:
+		return NewDNSFile()
+	case redisID:
+		return NewRedis()
+	case proxyFileID:
+		return NewProxyFile()
+	case xdsID:
+		return NewXDS()
+	case webhookID:
+		return NewWebhook()
+	case kubernetesID:
+		return NewKubernetes()
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownRegistry, id)
+}
+
+// registeredInstance describes one instance of service the way it was handed to a registry.
+func registeredInstance(srv *service.Service, instance service.Instance) *service.RegisteredService {
+	return &service.RegisteredService{
+		ID:         instance.ID,
+		Name:       instance.Name,
+		IP:         instance.IP,
+		IPv6:       instance.IPv6,
+		Port:       instance.Port,
+		Proto:      instance.Proto,
+		Tags:       srv.InstanceTags(instance),
+		Attributes: srv.Attributes(),
+		Config:     srv.Config(),
+	}
+}
+
+// instanceSet keeps in memory the instances handed to registries that render their own state.
+type instanceSet map[string]*service.RegisteredService
+
+func (set instanceSet) add(srv *service.Service) {
+	for _, instance := range srv.Instances() {
+		set[instance.ID] = registeredInstance(srv, instance)
+	}
+}
+
+func (set instanceSet) remove(srv *service.Service) {
+	for _, instance := range srv.Instances() {
+		delete(set, instance.ID)
+	}
+}
+
+// sorted returns the instances ordered by ID, so unchanged state renders identical files.
+func (set instanceSet) sorted() []*service.RegisteredService {
+	rv := []*service.RegisteredService{}
+	for _, instance := range set {
+		rv = append(rv, instance)
+	}
+
+	sort.Slice(rv, func(i, j int) bool { return rv[i].ID < rv[j].ID })
+	return rv
+}
+
+// proxied reports whether a proxy forwards to instance, proxies forward TCP and UDP only.
+func proxied(instance *service.RegisteredService) bool {
+	return !strings.EqualFold(instance.Proto, service.PROTO_SCTP)
+}
+
+// diagnoseUnproxied logs and returns a diagnostic for every instance of srv a proxy
+// registry skips.
+func diagnoseUnproxied(registry string, srv *service.Service) []service.Diagnostic {
+	rv := []service.Diagnostic{}
+	for _, instance := range srv.Instances() {
+		if proxied(registeredInstance(srv, instance)) {
+			continue
+		}
+
+		rv = append(rv, service.Diagnostic{
+			Label:    service.LabelPrefix() + "ports",
+			Severity: service.SEVERITY_WARNING,
+			Message:  fmt.Sprintf("%s: %s port %d skipped by %s, not supported", instance.ID, instance.Proto, instance.Port, registry),
+		})
+	}
+
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Message < rv[j].Message })
+	for _, diagnostic := range rv {
+		log.Println(diagnostic)
+	}
+
+	return rv
+}
@@ -0,0 +1,18 @@
+package registry
+
+import (
+	"github.com/njasm/clerk/internal/service"
+)
+
+func newTestService(labels map[string]string) *service.Service {
+	return service.NewFrom(service.Container{
+		ID:           "abc123",
+		Name:         "web",
+		Hostname:     "host",
+		Labels:       labels,
+		ExposedPorts: []string{"80/tcp"},
+		Networks: map[string]service.Network{
+			"bridge": {IPAddress: "10.0.0.2"},
+		},
+	})
+}
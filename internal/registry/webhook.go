@@ -0,0 +1,381 @@
+package registry
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const webhookID = "webhook"
+
+const (
+	envWebhookURLs        = "CLERK_WEBHOOK_URLS"
+	envWebhookSecret      = "CLERK_WEBHOOK_SECRET"
+	envWebhookOutbox      = "CLERK_WEBHOOK_OUTBOX"
+	envWebhookMaxAttempts = "CLERK_WEBHOOK_MAX_ATTEMPTS"
+	envWebhookBackoff     = "CLERK_WEBHOOK_BACKOFF"
+
+	defaultWebhookOutbox      = "/var/lib/clerk/webhook-outbox.json"
+	defaultWebhookMaxAttempts = "10"
+	defaultWebhookBackoff     = "1s"
+
+	webhookMaxBackoff = 5 * time.Minute
+
+	webhookEventRegister   = "register"
+	webhookEventUnregister = "unregister"
+)
+
+var ErrNoWebhookURL = errors.New("no webhook url configured")
+
+type webhookInstance struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	IP    string `json:"ip"`
+	Port  int    `json:"port"`
+	Proto string `json:"proto"`
+}
+
+// webhookEvent is the JSON document POSTed to every webhook URL.
+type webhookEvent struct {
+	Event       string            `json:"event"`
+	ContainerID string            `json:"container_id"`
+	Service     string            `json:"service"`
+	Instances   []webhookInstance `json:"instances"`
+	Tags        []string          `json:"tags"`
+	Attributes  map[string]string `json:"attributes"`
+	Timestamp   time.Time         `json:"timestamp"`
+}
+
+// webhookDelivery is one event waiting in the outbox to be delivered to one URL.
+type webhookDelivery struct {
+	ID          string          `json:"id"`
+	Event       string          `json:"event"`
+	URL         string          `json:"url"`
+	Body        json.RawMessage `json:"body"`
+	Attempts    int             `json:"attempts"`
+	NextAttempt time.Time       `json:"next_attempt"`
+}
+
+func NewWebhook() (clerk.Registry, error) {
+	urls := []string{}
+	for _, u := range strings.Split(utils.EnvOrDefault(envWebhookURLs, ""), ",") {
+		if u = strings.TrimSpace(u); u != "" {
+			urls = append(urls, u)
+		}
+	}
+
+	if len(urls) == 0 {
+		return nil, fmt.Errorf("error creating webhook registry: %w: set %s", ErrNoWebhookURL, envWebhookURLs)
+	}
+
+	maxAttempts, err := strconv.Atoi(utils.EnvOrDefault(envWebhookMaxAttempts, defaultWebhookMaxAttempts))
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook registry: %w", err)
+	}
+
+	backoff, err := time.ParseDuration(utils.EnvOrDefault(envWebhookBackoff, defaultWebhookBackoff))
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook registry: %w", err)
+	}
+
+	w, err := newWebhook(urls, os.Getenv(envWebhookSecret), utils.EnvOrDefault(envWebhookOutbox, defaultWebhookOutbox), &http.Client{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("error creating webhook registry: %w", err)
+	}
+
+	w.maxAttempts = maxAttempts
+	w.backoff = backoff
+
+	go func(w *Webhook, ticker *time.Ticker) {
+		for {
+			select {
+			case <-ticker.C:
+			case <-w.kick:
+			}
+
+			w.flush()
+		}
+	}(w, time.NewTicker(time.Second))
+
+	return w, nil
+}
+
+// newWebhook creates the webhook registry, loading the deliveries left in the outbox by a previous run.
+func newWebhook(urls []string, secret, outbox string, client *http.Client) (*Webhook, error) {
+	w := &Webhook{
+		urls:        urls,
+		secret:      []byte(secret),
+		outbox:      outbox,
+		client:      client,
+		maxAttempts: 10,
+		backoff:     time.Second,
+		kick:        make(chan struct{}, 1),
+		instances:   instanceSet{},
+		pending:     []*webhookDelivery{},
+	}
+
+	data, err := os.ReadFile(outbox)
+	if errors.Is(err, os.ErrNotExist) {
+		return w, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, &w.pending); err != nil {
+		return nil, fmt.Errorf("error reading webhook outbox %s: %w", outbox, err)
+	}
+
+	return w, nil
+}
+
+// Webhook POSTs a JSON event to every configured URL on each register and unregister.
+// Events are persisted in an outbox file until delivered, so they survive restarts, and
+// failed deliveries are retried with exponential backoff. When a secret is configured the
+// body is signed with HMAC-SHA256 in the `X-Clerk-Signature` header.
+type Webhook struct {
+	urls        []string
+	secret      []byte
+	outbox      string
+	client      *http.Client
+	maxAttempts int
+	backoff     time.Duration
+	kick        chan struct{}
+
+	mu        sync.Mutex
+	instances instanceSet
+	pending   []*webhookDelivery
+}
+
+func (w *Webhook) ID() string {
+	return webhookID
+}
+
+func (w *Webhook) Ping() error {
+	return nil
+}
+
+func (w *Webhook) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	w.mu.Lock()
+	w.instances.add(service)
+	w.mu.Unlock()
+
+	return w.enqueue(webhookEventRegister, service)
+}
+
+func (w *Webhook) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	w.mu.Lock()
+	w.instances.remove(service)
+	w.mu.Unlock()
+
+	return w.enqueue(webhookEventUnregister, service)
+}
+
+func (w *Webhook) Services() ([]*service.RegisteredService, error) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	return w.instances.sorted(), nil
+}
+
+func (w *Webhook) enqueue(event string, srv *service.Service) error {
+	payload := webhookEvent{
+		Event:       event,
+		ContainerID: srv.ContainerID(),
+		Service:     srv.Name(),
+		Instances:   []webhookInstance{},
+		Tags:        srv.Tags(),
+		Attributes:  srv.Attributes(),
+		Timestamp:   time.Now().UTC(),
+	}
+
+	for _, instance := range srv.Instances() {
+		payload.Instances = append(payload.Instances, webhookInstance{
+			ID:    instance.ID,
+			Name:  instance.Name,
+			IP:    instance.IP,
+			Port:  instance.Port,
+			Proto: instance.Proto,
+		})
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	for _, u := range w.urls {
+		w.pending = append(w.pending, &webhookDelivery{
+			ID:    deliveryID(),
+			Event: event,
+			URL:   u,
+			Body:  body,
+		})
+	}
+
+	if err := w.persist(); err != nil {
+		return err
+	}
+
+	select {
+	case w.kick <- struct{}{}:
+	default:
+	}
+
+	return nil
+}
+
+// flush attempts the due deliveries, and persists what is left. Deliveries to a URL are
+// sent in order, so the first one that isn't due or fails holds back the ones behind it:
+// a consumer never gets an event before an earlier one.
+func (w *Webhook) flush() {
+	w.mu.Lock()
+	queue := append([]*webhookDelivery{}, w.pending...)
+	w.mu.Unlock()
+
+	if len(queue) == 0 {
+		return
+	}
+
+	blocked := map[string]bool{}
+	done := map[*webhookDelivery]bool{}
+	for _, delivery := range queue {
+		if blocked[delivery.URL] {
+			continue
+		}
+
+		w.mu.Lock()
+		due := !delivery.NextAttempt.After(time.Now())
+		w.mu.Unlock()
+
+		if !due {
+			blocked[delivery.URL] = true
+			continue
+		}
+
+		err := w.deliver(delivery)
+		if err == nil {
+			done[delivery] = true
+			continue
+		}
+
+		w.mu.Lock()
+		delivery.Attempts++
+		if delivery.Attempts >= w.maxAttempts {
+			log.Println(fmt.Errorf("webhook: dropping %s to %s after %d attempts: %w", delivery.ID, delivery.URL, delivery.Attempts, err))
+			done[delivery] = true
+		} else {
+			backoff := w.backoff << (delivery.Attempts - 1)
+			if backoff <= 0 || backoff > webhookMaxBackoff {
+				backoff = webhookMaxBackoff
+			}
+
+			delivery.NextAttempt = time.Now().Add(backoff)
+			blocked[delivery.URL] = true
+			log.Println(fmt.Errorf("webhook: delivery %s to %s failed, retry in %s: %w", delivery.ID, delivery.URL, backoff, err))
+		}
+		w.mu.Unlock()
+	}
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+
+	pending := []*webhookDelivery{}
+	for _, delivery := range w.pending {
+		if !done[delivery] {
+			pending = append(pending, delivery)
+		}
+	}
+
+	w.pending = pending
+	if err := w.persist(); err != nil {
+		log.Println(fmt.Errorf("webhook: %w", err))
+	}
+}
+
+func (w *Webhook) deliver(delivery *webhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, delivery.URL, bytes.NewReader(delivery.Body))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("X-Clerk-Event", delivery.Event)
+	req.Header.Set("X-Clerk-Delivery", delivery.ID)
+	if len(w.secret) > 0 {
+		req.Header.Set("X-Clerk-Signature", "sha256="+sign(w.secret, delivery.Body))
+	}
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %s", delivery.URL, resp.Status)
+	}
+
+	return nil
+}
+
+func (w *Webhook) persist() error {
+	data, err := json.Marshal(w.pending)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(w.outbox), 0755); err != nil {
+		return err
+	}
+
+	if err := utils.WriteFileAtomic(w.outbox, data, 0600); err != nil {
+		return fmt.Errorf("error writing webhook outbox %s: %w", w.outbox, err)
+	}
+
+	return nil
+}
+
+// sign returns the hex encoded HMAC-SHA256 of body.
+func sign(secret, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func deliveryID() string {
+	id := make([]byte, 16)
+	_, _ = rand.Read(id)
+
+	return hex.EncodeToString(id)
+}
@@ -0,0 +1,167 @@
+package registry
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// webhookReceiver records the events it accepts, after failing the first `failures` requests.
+type webhookReceiver struct {
+	mu       sync.Mutex
+	failures int
+	requests int
+	events   []webhookEvent
+	headers  []http.Header
+}
+
+func (rc *webhookReceiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	rc.requests++
+	if rc.requests <= rc.failures {
+		w.WriteHeader(http.StatusBadGateway)
+		return
+	}
+
+	body, _ := io.ReadAll(r.Body)
+	if sign([]byte("s3cr3t"), body) != r.Header.Get("X-Clerk-Signature")[len("sha256="):] {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+
+	var event webhookEvent
+	_ = json.Unmarshal(body, &event)
+	rc.events = append(rc.events, event)
+	rc.headers = append(rc.headers, r.Header.Clone())
+}
+
+func TestWebhook(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	w, err := newWebhook([]string{server.URL}, "s3cr3t", filepath.Join(t.TempDir(), "outbox.json"), server.Client())
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.tags":       "primary",
+		"com.github.njasm.clerk.attributes": "region:eu-west-1",
+	})
+
+	assert.NoError(t, w.Register(srv))
+	assert.NoError(t, w.Unregister(srv))
+	w.flush()
+
+	assert.Len(t, receiver.events, 2)
+	assert.Equal(t, webhookEventRegister, receiver.events[0].Event)
+	assert.Equal(t, "abc123", receiver.events[0].ContainerID)
+	assert.Equal(t, "web", receiver.events[0].Service)
+	assert.Equal(t, []webhookInstance{{ID: "web:tcp:80:host", Name: "web", IP: "10.0.0.2", Port: 80, Proto: "tcp"}}, receiver.events[0].Instances)
+	assert.Equal(t, []string{"primary"}, receiver.events[0].Tags)
+	assert.Equal(t, map[string]string{"region": "eu-west-1"}, receiver.events[0].Attributes)
+	assert.Equal(t, webhookEventUnregister, receiver.events[1].Event)
+	assert.Equal(t, webhookEventUnregister, receiver.headers[1].Get("X-Clerk-Event"))
+	assert.Empty(t, w.pending)
+}
+
+func TestWebhookRetries(t *testing.T) {
+	receiver := &webhookReceiver{failures: 1}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	w, err := newWebhook([]string{server.URL}, "s3cr3t", filepath.Join(t.TempDir(), "outbox.json"), server.Client())
+	assert.NoError(t, err)
+	w.backoff = time.Millisecond
+
+	assert.NoError(t, w.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+	w.flush()
+	assert.Empty(t, receiver.events)
+	assert.Len(t, w.pending, 1)
+	assert.Equal(t, 1, w.pending[0].Attempts)
+
+	time.Sleep(2 * time.Millisecond)
+	w.flush()
+	assert.Len(t, receiver.events, 1)
+	assert.Empty(t, w.pending)
+}
+
+func TestWebhookKeepsOrderPerURL(t *testing.T) {
+	failing := &webhookReceiver{failures: 1}
+	failingServer := httptest.NewServer(failing)
+	defer failingServer.Close()
+
+	healthy := &webhookReceiver{}
+	healthyServer := httptest.NewServer(healthy)
+	defer healthyServer.Close()
+
+	w, err := newWebhook([]string{failingServer.URL, healthyServer.URL}, "s3cr3t", filepath.Join(t.TempDir(), "outbox.json"), healthyServer.Client())
+	assert.NoError(t, err)
+	w.backoff = time.Hour
+
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+	assert.NoError(t, w.Register(srv))
+	assert.NoError(t, w.Unregister(srv))
+
+	// the unregister waits behind the failed register, other URLs aren't held back
+	w.flush()
+	assert.Empty(t, failing.events)
+	assert.Equal(t, 1, failing.requests)
+	assert.Len(t, healthy.events, 2)
+	assert.Len(t, w.pending, 2)
+
+	// and it isn't sent either while the register waits for its retry
+	w.flush()
+	assert.Equal(t, 1, failing.requests)
+
+	w.pending[0].NextAttempt = time.Time{}
+	w.flush()
+	assert.Len(t, failing.events, 2)
+	assert.Equal(t, webhookEventRegister, failing.events[0].Event)
+	assert.Equal(t, webhookEventUnregister, failing.events[1].Event)
+	assert.Empty(t, w.pending)
+}
+
+func TestWebhookDropsAfterMaxAttempts(t *testing.T) {
+	receiver := &webhookReceiver{failures: 100}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	w, err := newWebhook([]string{server.URL}, "s3cr3t", filepath.Join(t.TempDir(), "outbox.json"), server.Client())
+	assert.NoError(t, err)
+	w.maxAttempts = 1
+
+	assert.NoError(t, w.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+	w.flush()
+	assert.Empty(t, w.pending)
+}
+
+func TestWebhookOutboxSurvivesRestart(t *testing.T) {
+	receiver := &webhookReceiver{}
+	server := httptest.NewServer(receiver)
+	defer server.Close()
+
+	outbox := filepath.Join(t.TempDir(), "outbox.json")
+	w, err := newWebhook([]string{server.URL}, "s3cr3t", outbox, server.Client())
+	assert.NoError(t, err)
+
+	// clerk stops before the event is delivered
+	assert.NoError(t, w.Register(newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})))
+
+	w, err = newWebhook([]string{server.URL}, "s3cr3t", outbox, server.Client())
+	assert.NoError(t, err)
+	assert.Len(t, w.pending, 1)
+
+	w.flush()
+	assert.Len(t, receiver.events, 1)
+	assert.Equal(t, "web", receiver.events[0].Service)
+}
@@ -0,0 +1,217 @@
+package registry
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	clusterservice "github.com/envoyproxy/go-control-plane/envoy/service/cluster/v3"
+	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	endpointservice "github.com/envoyproxy/go-control-plane/envoy/service/endpoint/v3"
+	"github.com/envoyproxy/go-control-plane/pkg/cache/types"
+	cache "github.com/envoyproxy/go-control-plane/pkg/cache/v3"
+	resource "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	server "github.com/envoyproxy/go-control-plane/pkg/server/v3"
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+	"google.golang.org/grpc"
+	"google.golang.org/protobuf/types/known/durationpb"
+)
+
+const xdsID = "xds"
+
+const (
+	envXDSAddress = "CLERK_XDS_ADDRESS"
+
+	defaultXDSAddress = "127.0.0.1:18000"
+
+	// every node gets the same snapshot
+	xdsSnapshotKey = "clerk"
+)
+
+// xdsNodeHash maps every Envoy or gRPC node to the single clerk snapshot.
+type xdsNodeHash struct{}
+
+func (xdsNodeHash) ID(*core.Node) string {
+	return xdsSnapshotKey
+}
+
+func NewXDS() (clerk.Registry, error) {
+	listener, err := net.Listen("tcp", utils.EnvOrDefault(envXDSAddress, defaultXDSAddress))
+	if err != nil {
+		return nil, fmt.Errorf("error creating xds registry: %w", err)
+	}
+
+	x, err := newXDS()
+	if err != nil {
+		return nil, fmt.Errorf("error creating xds registry: %w", err)
+	}
+
+	go func(x *XDS, listener net.Listener) {
+		if err := x.serve(listener); err != nil {
+			log.Println(fmt.Errorf("xds: server stopped: %w", err))
+		}
+	}(x, listener)
+
+	return x, nil
+}
+
+func newXDS() (*XDS, error) {
+	x := &XDS{
+		cache:     cache.NewSnapshotCache(false, xdsNodeHash{}, nil),
+		instances: instanceSet{},
+	}
+
+	return x, x.snapshot()
+}
+
+// XDS serves the registered instances over gRPC as an xDS control plane, with one EDS
+// cluster per service name, so Envoy and gRPC xDS clients discover containers from clerk.
+type XDS struct {
+	cache cache.SnapshotCache
+
+	mu        sync.Mutex
+	version   uint64
+	instances instanceSet
+}
+
+func (x *XDS) ID() string {
+	return xdsID
+}
+
+func (x *XDS) Ping() error {
+	return nil
+}
+
+func (x *XDS) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	diagnoseUnproxied(xdsID, service)
+	x.instances.add(service)
+	return x.snapshot()
+}
+
+func (x *XDS) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	x.instances.remove(service)
+	return x.snapshot()
+}
+
+func (x *XDS) Services() ([]*service.RegisteredService, error) {
+	x.mu.Lock()
+	defer x.mu.Unlock()
+
+	return x.instances.sorted(), nil
+}
+
+// serve runs the CDS, EDS and ADS services on listener, until it is closed.
+func (x *XDS) serve(listener net.Listener) error {
+	srv := server.NewServer(context.Background(), x.cache, nil)
+	grpcServer := grpc.NewServer()
+	discoverygrpc.RegisterAggregatedDiscoveryServiceServer(grpcServer, srv)
+	clusterservice.RegisterClusterDiscoveryServiceServer(grpcServer, srv)
+	endpointservice.RegisterEndpointDiscoveryServiceServer(grpcServer, srv)
+
+	return grpcServer.Serve(listener)
+}
+
+// snapshot publishes a new version of the clusters and their endpoints.
+func (x *XDS) snapshot() error {
+	clusters := []types.Resource{}
+	assignments := map[string]*endpoint.ClusterLoadAssignment{}
+	for _, instance := range x.instances.sorted() {
+		if !proxied(instance) {
+			continue
+		}
+
+		assignment, ok := assignments[instance.Name]
+		if !ok {
+			assignment = &endpoint.ClusterLoadAssignment{
+				ClusterName: instance.Name,
+				Endpoints:   []*endpoint.LocalityLbEndpoints{{}},
+			}
+
+			assignments[instance.Name] = assignment
+			clusters = append(clusters, xdsCluster(instance.Name))
+		}
+
+		assignment.Endpoints[0].LbEndpoints = append(assignment.Endpoints[0].LbEndpoints, xdsEndpoint(instance))
+	}
+
+	endpoints := []types.Resource{}
+	for _, c := range clusters {
+		endpoints = append(endpoints, assignments[c.(*cluster.Cluster).Name])
+	}
+
+	x.version++
+	snapshot, err := cache.NewSnapshot(strconv.FormatUint(x.version, 10), map[resource.Type][]types.Resource{
+		resource.ClusterType:  clusters,
+		resource.EndpointType: endpoints,
+	})
+	if err != nil {
+		return err
+	}
+
+	if err := snapshot.Consistent(); err != nil {
+		return err
+	}
+
+	return x.cache.SetSnapshot(context.Background(), xdsSnapshotKey, snapshot)
+}
+
+func xdsCluster(name string) *cluster.Cluster {
+	return &cluster.Cluster{
+		Name:                 name,
+		ConnectTimeout:       durationpb.New(5 * time.Second),
+		ClusterDiscoveryType: &cluster.Cluster_Type{Type: cluster.Cluster_EDS},
+		EdsClusterConfig: &cluster.Cluster_EdsClusterConfig{
+			EdsConfig: &core.ConfigSource{
+				ResourceApiVersion:    core.ApiVersion_V3,
+				ConfigSourceSpecifier: &core.ConfigSource_Ads{Ads: &core.AggregatedConfigSource{}},
+			},
+		},
+	}
+}
+
+func xdsEndpoint(instance *service.RegisteredService) *endpoint.LbEndpoint {
+	protocol := core.SocketAddress_TCP
+	if strings.EqualFold(instance.Proto, "udp") {
+		protocol = core.SocketAddress_UDP
+	}
+
+	return &endpoint.LbEndpoint{
+		HostIdentifier: &endpoint.LbEndpoint_Endpoint{
+			Endpoint: &endpoint.Endpoint{
+				Address: &core.Address{
+					Address: &core.Address_SocketAddress{
+						SocketAddress: &core.SocketAddress{
+							Protocol:      protocol,
+							Address:       instance.IP,
+							PortSpecifier: &core.SocketAddress_PortValue{PortValue: uint32(instance.Port)},
+						},
+					},
+				},
+			},
+		},
+	}
+}
@@ -0,0 +1,102 @@
+package registry
+
+import (
+	"context"
+	"net"
+	"testing"
+	"time"
+
+	cluster "github.com/envoyproxy/go-control-plane/envoy/config/cluster/v3"
+	core "github.com/envoyproxy/go-control-plane/envoy/config/core/v3"
+	endpoint "github.com/envoyproxy/go-control-plane/envoy/config/endpoint/v3"
+	discoverygrpc "github.com/envoyproxy/go-control-plane/envoy/service/discovery/v3"
+	resource "github.com/envoyproxy/go-control-plane/pkg/resource/v3"
+	"github.com/stretchr/testify/assert"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+)
+
+func TestXDS(t *testing.T) {
+	x, err := newXDS()
+	assert.NoError(t, err)
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	defer listener.Close()
+	go func() { _ = x.serve(listener) }()
+
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+	assert.NoError(t, x.Register(srv))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	conn, err := grpc.DialContext(ctx, listener.Addr().String(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+	assert.NoError(t, err)
+	defer conn.Close()
+
+	stream, err := discoverygrpc.NewAggregatedDiscoveryServiceClient(conn).StreamAggregatedResources(ctx)
+	assert.NoError(t, err)
+
+	node := &core.Node{Id: "envoy-test"}
+	assert.NoError(t, stream.Send(&discoverygrpc.DiscoveryRequest{Node: node, TypeUrl: resource.ClusterType}))
+	response, err := stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "2", response.VersionInfo)
+	assert.Len(t, response.Resources, 1)
+
+	var c cluster.Cluster
+	assert.NoError(t, response.Resources[0].UnmarshalTo(&c))
+	assert.Equal(t, "web", c.Name)
+	assert.Equal(t, cluster.Cluster_EDS, c.GetType())
+
+	assert.NoError(t, stream.Send(&discoverygrpc.DiscoveryRequest{Node: node, TypeUrl: resource.EndpointType, ResourceNames: []string{"web"}}))
+	response, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Len(t, response.Resources, 1)
+
+	var assignment endpoint.ClusterLoadAssignment
+	assert.NoError(t, response.Resources[0].UnmarshalTo(&assignment))
+	address := assignment.Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress()
+	assert.Equal(t, "10.0.0.2", address.Address)
+	assert.Equal(t, uint32(80), address.GetPortValue())
+
+	// ack the endpoints, the next version is pushed once the instance is gone
+	assert.NoError(t, stream.Send(&discoverygrpc.DiscoveryRequest{
+		Node: node, TypeUrl: resource.EndpointType, ResourceNames: []string{"web"},
+		VersionInfo: response.VersionInfo, ResponseNonce: response.Nonce,
+	}))
+	assert.NoError(t, x.Unregister(srv))
+
+	response, err = stream.Recv()
+	assert.NoError(t, err)
+	assert.Equal(t, "3", response.VersionInfo)
+	assert.Empty(t, response.Resources)
+}
+
+func TestXDSSkipsSCTP(t *testing.T) {
+	x, err := newXDS()
+	assert.NoError(t, err)
+
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":  "web",
+		"com.github.njasm.clerk.ports": "80/tcp,3868/sctp",
+	})
+
+	diagnostics := diagnoseUnproxied(xdsID, srv)
+	assert.Len(t, diagnostics, 1)
+	assert.Contains(t, diagnostics[0].Message, "sctp port 3868 skipped by xds")
+
+	assert.NoError(t, x.Register(srv))
+
+	snapshot, err := x.cache.GetSnapshot(xdsSnapshotKey)
+	assert.NoError(t, err)
+
+	endpoints := snapshot.GetResources(resource.EndpointType)
+	assert.Len(t, endpoints, 1)
+	assignment := endpoints["web"].(*endpoint.ClusterLoadAssignment)
+	assert.Len(t, assignment.Endpoints[0].LbEndpoints, 1)
+	address := assignment.Endpoints[0].LbEndpoints[0].GetEndpoint().Address.GetSocketAddress()
+	assert.Equal(t, core.SocketAddress_TCP, address.Protocol)
+	assert.Equal(t, uint32(80), address.GetPortValue())
+}
@@ -0,0 +1,287 @@
+package registry
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"path"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-zookeeper/zk"
+	clerk "github.com/njasm/clerk/internal"
+	service "github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const zookeeperID = "zookeeper"
+
+const (
+	envZookeeperServers        = "CLERK_ZOOKEEPER_SERVERS"
+	envZookeeperBasePath       = "CLERK_ZOOKEEPER_BASE_PATH"
+	envZookeeperSessionTimeout = "CLERK_ZOOKEEPER_SESSION_TIMEOUT"
+
+	defaultZookeeperServers        = "127.0.0.1:2181"
+	defaultZookeeperBasePath       = "/services"
+	defaultZookeeperSessionTimeout = "10s"
+
+	// spring cloud zookeeper payload class, so attributes show up as instance metadata
+	curatorPayloadClass = "org.springframework.cloud.zookeeper.discovery.ZookeeperInstance"
+)
+
+// zkConn is the subset of *zk.Conn used by the Zookeeper registry.
+type zkConn interface {
+	Create(path string, data []byte, flags int32, acl []zk.ACL) (string, error)
+	Delete(path string, version int32) error
+	Children(path string) ([]string, *zk.Stat, error)
+	Get(path string) ([]byte, *zk.Stat, error)
+	Set(path string, data []byte, version int32) (*zk.Stat, error)
+	Exists(path string) (bool, *zk.Stat, error)
+	SessionID() int64
+}
+
+// curatorInstance is the JSON document Curator's ServiceDiscovery stores in each instance znode.
+type curatorInstance struct {
+	Name                string          `json:"name"`
+	ID                  string          `json:"id"`
+	Address             string          `json:"address"`
+	Port                *int            `json:"port"`
+	SSLPort             *int            `json:"sslPort"`
+	Payload             *curatorPayload `json:"payload"`
+	RegistrationTimeUTC int64           `json:"registrationTimeUTC"`
+	ServiceType         string          `json:"serviceType"`
+	URISpec             interface{}     `json:"uriSpec"`
+}
+
+type curatorPayload struct {
+	Class    string            `json:"@class"`
+	ID       string            `json:"id"`
+	Name     string            `json:"name"`
+	Metadata map[string]string `json:"metadata"`
+}
+
+func NewZookeeper() (clerk.Registry, error) {
+	timeout, err := time.ParseDuration(utils.EnvOrDefault(envZookeeperSessionTimeout, defaultZookeeperSessionTimeout))
+	if err != nil {
+		return nil, fmt.Errorf("error creating zookeeper registry: %w", err)
+	}
+
+	servers := strings.Split(utils.EnvOrDefault(envZookeeperServers, defaultZookeeperServers), ",")
+	conn, events, err := zk.Connect(servers, timeout)
+	if err != nil {
+		return nil, fmt.Errorf("error creating zookeeper registry: %w", err)
+	}
+
+	z := newZookeeper(conn, utils.EnvOrDefault(envZookeeperBasePath, defaultZookeeperBasePath))
+	go z.watch(events)
+
+	return z, nil
+}
+
+func newZookeeper(conn zkConn, basePath string) *Zookeeper {
+	return &Zookeeper{
+		conn:     conn,
+		basePath: "/" + strings.Trim(basePath, "/"),
+		nodes:    map[string][]byte{},
+	}
+}
+
+// Zookeeper registers every instance as an ephemeral znode at `<base path>/<name>/<instance id>`.
+type Zookeeper struct {
+	conn     zkConn
+	basePath string
+
+	mu    sync.Mutex
+	nodes map[string][]byte
+}
+
+func (z *Zookeeper) ID() string {
+	return zookeeperID
+}
+
+func (z *Zookeeper) Ping() error {
+	_, _, err := z.conn.Exists(z.basePath)
+	return err
+}
+
+func (z *Zookeeper) Register(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for _, instance := range service.Instances() {
+		port := instance.Port
+		data, err := json.Marshal(curatorInstance{
+			Name:                instance.Name,
+			ID:                  instance.ID,
+			Address:             instance.IP,
+			Port:                &port,
+			RegistrationTimeUTC: time.Now().UnixMilli(),
+			ServiceType:         "DYNAMIC",
+			Payload: &curatorPayload{
+				Class:    curatorPayloadClass,
+				ID:       instance.ID,
+				Name:     instance.Name,
+				Metadata: service.Attributes(),
+			},
+		})
+		if err != nil {
+			return err
+		}
+
+		nodePath := path.Join(z.basePath, instance.Name, instance.ID)
+		err = z.create(nodePath, data)
+		if err != nil {
+			return err
+		}
+
+		z.nodes[nodePath] = data
+	}
+
+	return nil
+}
+
+func (z *Zookeeper) Unregister(service *service.Service) error {
+	if service == nil {
+		return ErrServiceIsNil
+	}
+
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for _, instance := range service.Instances() {
+		nodePath := path.Join(z.basePath, instance.Name, instance.ID)
+		delete(z.nodes, nodePath)
+
+		err := z.conn.Delete(nodePath, -1)
+		if err != nil && !errors.Is(err, zk.ErrNoNode) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (z *Zookeeper) Services() ([]*service.RegisteredService, error) {
+	rv := []*service.RegisteredService{}
+	names, _, err := z.conn.Children(z.basePath)
+	if errors.Is(err, zk.ErrNoNode) {
+		return rv, nil
+	}
+
+	if err != nil {
+		return rv, err
+	}
+
+	for _, name := range names {
+		ids, _, err := z.conn.Children(path.Join(z.basePath, name))
+		if err != nil {
+			return rv, err
+		}
+
+		for _, id := range ids {
+			data, _, err := z.conn.Get(path.Join(z.basePath, name, id))
+			if errors.Is(err, zk.ErrNoNode) {
+				continue
+			}
+
+			if err != nil {
+				return rv, err
+			}
+
+			var instance curatorInstance
+			if err := json.Unmarshal(data, &instance); err != nil {
+				log.Println(fmt.Errorf("zookeeper: skipping %s/%s: %w", name, id, err))
+				continue
+			}
+
+			s := &service.RegisteredService{
+				ID:   instance.ID,
+				Name: instance.Name,
+				IP:   instance.Address,
+			}
+
+			if instance.Port != nil {
+				s.Port = *instance.Port
+			}
+
+			if instance.Payload != nil {
+				s.Attributes = instance.Payload.Metadata
+			}
+
+			rv = append(rv, s)
+		}
+	}
+
+	return rv, nil
+}
+
+// watch re-creates the znodes of this clerk every time a session is established,
+// ephemeral nodes are gone once a session expires.
+func (z *Zookeeper) watch(events <-chan zk.Event) {
+	for event := range events {
+		if event.Type != zk.EventSession {
+			continue
+		}
+
+		switch event.State {
+		case zk.StateExpired:
+			log.Println("zookeeper: session expired")
+		case zk.StateHasSession:
+			z.restore()
+		}
+	}
+}
+
+func (z *Zookeeper) restore() {
+	z.mu.Lock()
+	defer z.mu.Unlock()
+
+	for nodePath, data := range z.nodes {
+		if err := z.create(nodePath, data); err != nil {
+			log.Println(fmt.Errorf("zookeeper: error restoring %s: %w", nodePath, err))
+		}
+	}
+}
+
+// create writes an ephemeral znode, creating its parents as persistent nodes.
+// A node left behind by a previous, not yet expired, session is replaced.
+func (z *Zookeeper) create(nodePath string, data []byte) error {
+	acl := zk.WorldACL(zk.PermAll)
+	parent := ""
+	for _, part := range strings.Split(strings.Trim(path.Dir(nodePath), "/"), "/") {
+		parent += "/" + part
+		_, err := z.conn.Create(parent, nil, 0, acl)
+		if err != nil && !errors.Is(err, zk.ErrNodeExists) {
+			return err
+		}
+	}
+
+	_, err := z.conn.Create(nodePath, data, zk.FlagEphemeral, acl)
+	if !errors.Is(err, zk.ErrNodeExists) {
+		return err
+	}
+
+	_, stat, err := z.conn.Exists(nodePath)
+	if err != nil {
+		return err
+	}
+
+	if stat != nil && stat.EphemeralOwner == z.conn.SessionID() {
+		_, err = z.conn.Set(nodePath, data, -1)
+		return err
+	}
+
+	err = z.conn.Delete(nodePath, -1)
+	if err != nil && !errors.Is(err, zk.ErrNoNode) {
+		return err
+	}
+
+	_, err = z.conn.Create(nodePath, data, zk.FlagEphemeral, acl)
+	return err
+}
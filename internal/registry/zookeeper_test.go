@@ -0,0 +1,203 @@
+package registry
+
+import (
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/go-zookeeper/zk"
+	"github.com/stretchr/testify/assert"
+)
+
+type fakeZnode struct {
+	data  []byte
+	owner int64
+}
+
+// fakeZkConn is an in-memory stand-in for a ZooKeeper ensemble.
+type fakeZkConn struct {
+	mu      sync.Mutex
+	session int64
+	nodes   map[string]*fakeZnode
+}
+
+func newFakeZkConn() *fakeZkConn {
+	return &fakeZkConn{session: 1, nodes: map[string]*fakeZnode{"/": {}}}
+}
+
+func (f *fakeZkConn) Create(p string, data []byte, flags int32, _ []zk.ACL) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[p]; ok {
+		return "", zk.ErrNodeExists
+	}
+
+	if _, ok := f.nodes[path.Dir(p)]; !ok {
+		return "", zk.ErrNoNode
+	}
+
+	node := &fakeZnode{data: data}
+	if flags&zk.FlagEphemeral != 0 {
+		node.owner = f.session
+	}
+
+	f.nodes[p] = node
+	return p, nil
+}
+
+func (f *fakeZkConn) Delete(p string, _ int32) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[p]; !ok {
+		return zk.ErrNoNode
+	}
+
+	delete(f.nodes, p)
+	return nil
+}
+
+func (f *fakeZkConn) Children(p string) ([]string, *zk.Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if _, ok := f.nodes[p]; !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+
+	rv := []string{}
+	for key := range f.nodes {
+		if key != "/" && path.Dir(key) == p {
+			rv = append(rv, path.Base(key))
+		}
+	}
+
+	sort.Strings(rv)
+	return rv, &zk.Stat{}, nil
+}
+
+func (f *fakeZkConn) Get(p string) ([]byte, *zk.Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, ok := f.nodes[p]
+	if !ok {
+		return nil, nil, zk.ErrNoNode
+	}
+
+	return node.data, &zk.Stat{EphemeralOwner: node.owner}, nil
+}
+
+func (f *fakeZkConn) Set(p string, data []byte, _ int32) (*zk.Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, ok := f.nodes[p]
+	if !ok {
+		return nil, zk.ErrNoNode
+	}
+
+	node.data = data
+	return &zk.Stat{EphemeralOwner: node.owner}, nil
+}
+
+func (f *fakeZkConn) Exists(p string) (bool, *zk.Stat, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	node, ok := f.nodes[p]
+	if !ok {
+		return false, nil, nil
+	}
+
+	return true, &zk.Stat{EphemeralOwner: node.owner}, nil
+}
+
+func (f *fakeZkConn) SessionID() int64 {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return f.session
+}
+
+// expire drops every ephemeral node and starts a new session.
+func (f *fakeZkConn) expire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for key, node := range f.nodes {
+		if node.owner != 0 {
+			delete(f.nodes, key)
+		}
+	}
+
+	f.session++
+}
+
+func TestZookeeperRegister(t *testing.T) {
+	conn := newFakeZkConn()
+	z := newZookeeper(conn, "/services/")
+	srv := newTestService(map[string]string{
+		"com.github.njasm.clerk.name":       "web",
+		"com.github.njasm.clerk.attributes": "region:eu-west-1",
+	})
+
+	assert.NoError(t, z.Ping())
+	assert.NoError(t, z.Register(srv))
+
+	data, stat, err := conn.Get("/services/web/web:tcp:80:host")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(1), stat.EphemeralOwner)
+	assert.True(t, strings.Contains(string(data), `"serviceType":"DYNAMIC"`))
+	assert.True(t, strings.Contains(string(data), `"address":"10.0.0.2"`))
+
+	services, err := z.Services()
+	assert.NoError(t, err)
+	assert.Len(t, services, 1)
+	assert.Equal(t, "web:tcp:80:host", services[0].ID)
+	assert.Equal(t, "web", services[0].Name)
+	assert.Equal(t, "10.0.0.2", services[0].IP)
+	assert.Equal(t, 80, services[0].Port)
+	assert.Equal(t, map[string]string{"region": "eu-west-1"}, services[0].Attributes)
+
+	assert.NoError(t, z.Unregister(srv))
+	services, err = z.Services()
+	assert.NoError(t, err)
+	assert.Empty(t, services)
+}
+
+func TestZookeeperRestoreAfterSessionExpiry(t *testing.T) {
+	conn := newFakeZkConn()
+	z := newZookeeper(conn, "/services")
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+
+	assert.NoError(t, z.Register(srv))
+	conn.expire()
+
+	services, err := z.Services()
+	assert.NoError(t, err)
+	assert.Empty(t, services)
+
+	z.restore()
+
+	_, stat, err := conn.Get("/services/web/web:tcp:80:host")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stat.EphemeralOwner)
+}
+
+func TestZookeeperReplacesStaleNode(t *testing.T) {
+	conn := newFakeZkConn()
+	z := newZookeeper(conn, "/services")
+	srv := newTestService(map[string]string{"com.github.njasm.clerk.name": "web"})
+
+	assert.NoError(t, z.Register(srv))
+	conn.session++
+
+	assert.NoError(t, z.Register(srv))
+	_, stat, err := conn.Get("/services/web/web:tcp:80:host")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2), stat.EphemeralOwner)
+}
@@ -0,0 +1,458 @@
+package runtime
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/containerd/containerd"
+	apievents "github.com/containerd/containerd/api/events"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	"github.com/containerd/typeurl"
+	clerk "github.com/njasm/clerk/internal"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const containerdID = "containerd"
+
+const (
+	envContainerdAddress   = "CLERK_CONTAINERD_ADDRESS"
+	envContainerdNamespace = "CLERK_CONTAINERD_NAMESPACE"
+	envContainerdProc      = "CLERK_CONTAINERD_PROC"
+
+	defaultContainerdAddress   = "/run/containerd/containerd.sock"
+	defaultContainerdNamespace = "default"
+	defaultContainerdProc      = "/proc"
+
+	// labels set by nerdctl on the containers it creates
+	nerdctlName     = "nerdctl/name"
+	nerdctlHostname = "nerdctl/hostname"
+	nerdctlNetworks = "nerdctl/networks"
+	nerdctlPorts    = "nerdctl/ports"
+	nerdctlIP       = "nerdctl/ip"
+	nerdctlIP6      = "nerdctl/ip6"
+
+	// network name nerdctl gives to --net=host
+	nerdctlHostNetwork = "host"
+)
+
+// nerdctlPort is a port mapping of the nerdctl/ports label.
+type nerdctlPort struct {
+	HostPort      int32
+	ContainerPort int32
+	Protocol      string
+	HostIP        string
+}
+
+func NewContainerd() (clerk.Runtime, error) {
+	client, err := containerd.New(
+		utils.EnvOrDefault(envContainerdAddress, defaultContainerdAddress),
+		containerd.WithDefaultNamespace(utils.EnvOrDefault(envContainerdNamespace, defaultContainerdNamespace)),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating containerd runtime: %w", err)
+	}
+
+	return &Containerd{
+		client:    client,
+		namespace: utils.EnvOrDefault(envContainerdNamespace, defaultContainerdNamespace),
+		proc:      utils.EnvOrDefault(envContainerdProc, defaultContainerdProc),
+	}, nil
+}
+
+// Containerd watches the containers of a containerd namespace. Names, hostnames, networks
+// and ports are read from the labels nerdctl sets, and the addresses from the network
+// namespace of the container task through proc, so clerk needs the host pid namespace
+// or the host /proc mounted at CLERK_CONTAINERD_PROC.
+type Containerd struct {
+	client    *containerd.Client
+	namespace string
+	proc      string
+}
+
+func (c *Containerd) ID() string {
+	return containerdID
+}
+
+// List returns the containers with a running task.
+func (c *Containerd) List(ctx context.Context) ([]string, error) {
+	list, err := c.client.Containers(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := []string{}
+	for _, container := range list {
+		task, err := container.Task(ctx, nil)
+		if err != nil {
+			continue
+		}
+
+		status, err := task.Status(ctx)
+		if err != nil || status.Status != containerd.Running {
+			continue
+		}
+
+		rv = append(rv, container.ID())
+	}
+
+	return rv, nil
+}
+
+func (c *Containerd) Inspect(ctx context.Context, containerID string) (service.Container, error) {
+	container, err := c.client.LoadContainer(ctx, containerID)
+	if err != nil {
+		return service.Container{}, err
+	}
+
+	info, err := container.Info(ctx)
+	if err != nil {
+		return service.Container{}, err
+	}
+
+	spec, err := container.Spec(ctx)
+	if err != nil {
+		return service.Container{}, err
+	}
+
+	rv := fromNerdctl(info, spec)
+
+	// a stopped container has no task, and no address, but is still described for unregister.
+	// Addresses read from the namespace of a host network container would be the host ones.
+	task, err := container.Task(ctx, nil)
+	if err != nil || rv.HostNetwork {
+		return rv, nil
+	}
+
+	networks, err := c.taskAddresses(ctx, task, nerdctlNetworkNames(info.Labels), rv.Networks)
+	if err != nil {
+		return rv, fmt.Errorf("containerd: reading addresses of %s: %w", containerID, err)
+	}
+
+	rv.Networks = networks
+	return rv, nil
+}
+
+// containerdTask is the part of a containerd task its addresses are read from.
+type containerdTask interface {
+	Pid() uint32
+	Status(ctx context.Context) (containerd.Status, error)
+}
+
+// taskAddresses reads the addresses of networks from the network namespace of a running
+// task. The task of a container is still there on its exit event, once its process is
+// gone, and its pid may belong to another process already, so only running tasks are read
+// and a task without proc directory has no address.
+func (c *Containerd) taskAddresses(ctx context.Context, task containerdTask, order []string, networks map[string]service.Network) (map[string]service.Network, error) {
+	status, err := task.Status(ctx)
+	if err != nil || status.Status != containerd.Running {
+		return networks, nil
+	}
+
+	procNet := filepath.Join(c.proc, strconv.FormatUint(uint64(task.Pid()), 10), "net")
+	rv, err := netnsAddresses(procNet, order, networks)
+	if errors.Is(err, os.ErrNotExist) {
+		return networks, nil
+	}
+
+	return rv, err
+}
+
+func (c *Containerd) Events(ctx context.Context) (<-chan clerk.ContainerEvent, <-chan error) {
+	envelopes, errs := c.client.Subscribe(ctx, `topic=="/tasks/start"`, `topic=="/tasks/exit"`)
+
+	rv := make(chan clerk.ContainerEvent)
+	go func() {
+		for {
+			select {
+			case envelope := <-envelopes:
+				if envelope == nil || envelope.Namespace != c.namespace {
+					continue
+				}
+
+				event, err := typeurl.UnmarshalAny(envelope.Event)
+				if err != nil {
+					continue
+				}
+
+				var message clerk.ContainerEvent
+				switch e := event.(type) {
+				case *apievents.TaskStart:
+					message = clerk.ContainerEvent{ContainerID: e.ContainerID, Action: clerk.EVENT_START}
+				case *apievents.TaskExit:
+					// exec processes exit too, only the init process stops the container
+					if e.ID != e.ContainerID {
+						continue
+					}
+
+					message = clerk.ContainerEvent{ContainerID: e.ContainerID, Action: clerk.EVENT_DIE}
+				default:
+					continue
+				}
+
+				select {
+				case rv <- message:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return rv, errs
+}
+
+// fromNerdctl describes a containerd container, with the networks named after the
+// nerdctl/networks label and the static addresses of nerdctl/ip and nerdctl/ip6.
+func fromNerdctl(info containers.Container, spec *oci.Spec) service.Container {
+	rv := service.Container{
+		ID:             info.ID,
+		Name:           info.ID,
+		Image:          info.Image,
+		Labels:         map[string]string{},
+		Env:            []string{},
+		ExposedPorts:   []string{},
+		PublishedPorts: map[string]int{},
+		Networks:       map[string]service.Network{},
+	}
+
+	for key, value := range info.Labels {
+		rv.Labels[key] = value
+	}
+
+	if name := info.Labels[nerdctlName]; name != "" {
+		rv.Name = name
+	}
+
+	if spec != nil {
+		rv.Hostname = spec.Hostname
+		if spec.Process != nil {
+			rv.Env = append(rv.Env, spec.Process.Env...)
+		}
+	}
+
+	if hostname := info.Labels[nerdctlHostname]; hostname != "" {
+		rv.Hostname = hostname
+	}
+
+	ports := []nerdctlPort{}
+	_ = json.Unmarshal([]byte(info.Labels[nerdctlPorts]), &ports)
+	seen := map[string]bool{}
+	for _, port := range ports {
+		proto := strings.ToLower(port.Protocol)
+		if proto == "" {
+			proto = "tcp"
+		}
+
+		exposed := fmt.Sprintf("%d/%s", port.ContainerPort, proto)
+		if !seen[exposed] {
+			seen[exposed] = true
+			rv.ExposedPorts = append(rv.ExposedPorts, exposed)
+		}
+
+		if ip := net.ParseIP(port.HostIP); port.HostPort > 0 && (ip == nil || !ip.IsLoopback()) {
+			if _, ok := rv.PublishedPorts[exposed]; !ok {
+				rv.PublishedPorts[exposed] = int(port.HostPort)
+			}
+		}
+	}
+
+	sort.Strings(rv.ExposedPorts)
+
+	networks := nerdctlNetworkNames(info.Labels)
+	for _, network := range networks {
+		rv.Networks[network] = service.Network{}
+		rv.HostNetwork = rv.HostNetwork || network == nerdctlHostNetwork
+	}
+
+	// static addresses only apply to the first network
+	if len(networks) > 0 {
+		rv.Networks[networks[0]] = service.Network{
+			IPAddress:         info.Labels[nerdctlIP],
+			GlobalIPv6Address: info.Labels[nerdctlIP6],
+		}
+	}
+
+	return rv
+}
+
+func nerdctlNetworkNames(labels map[string]string) []string {
+	rv := []string{}
+	_ = json.Unmarshal([]byte(labels[nerdctlNetworks]), &rv)
+
+	return rv
+}
+
+// netnsAddresses fills the addresses of networks from the proc net directory of the
+// container network namespace. nerdctl names the interface of the n-th network ethn, so
+// interfaces are mapped to networks in the order of the nerdctl/networks label.
+func netnsAddresses(procNet string, order []string, networks map[string]service.Network) (map[string]service.Network, error) {
+	rv := map[string]service.Network{}
+	for name, network := range networks {
+		rv[name] = network
+	}
+
+	interfaces, err := ipv4Interfaces(procNet)
+	if err != nil {
+		return nil, err
+	}
+
+	ipv6, err := ipv6Interfaces(procNet)
+	if err != nil {
+		return nil, err
+	}
+
+	for iface, ip := range ipv6 {
+		if _, ok := interfaces[iface]; !ok {
+			interfaces[iface] = service.Network{}
+		}
+
+		network := interfaces[iface]
+		network.GlobalIPv6Address = ip
+		interfaces[iface] = network
+	}
+
+	for iface, addresses := range interfaces {
+		name := iface
+		if index, err := strconv.Atoi(strings.TrimPrefix(iface, "eth")); err == nil && strings.HasPrefix(iface, "eth") && index < len(order) {
+			name = order[index]
+		}
+
+		network := rv[name]
+		if network.IPAddress == "" {
+			network.IPAddress = addresses.IPAddress
+		}
+
+		if network.GlobalIPv6Address == "" {
+			network.GlobalIPv6Address = addresses.GlobalIPv6Address
+		}
+
+		rv[name] = network
+	}
+
+	return rv, nil
+}
+
+// ipv4Interfaces returns the local IPv4 address of every interface, matching the local
+// addresses of fib_trie with the routes of each interface.
+func ipv4Interfaces(procNet string) (map[string]service.Network, error) {
+	rv := map[string]service.Network{}
+
+	trie, err := os.Open(filepath.Join(procNet, "fib_trie"))
+	if err != nil {
+		return nil, err
+	}
+	defer trie.Close()
+
+	addresses := []net.IP{}
+	seen := map[string]bool{}
+	var current string
+	scanner := bufio.NewScanner(trie)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if strings.HasPrefix(line, "|-- ") {
+			current = strings.TrimPrefix(line, "|-- ")
+			continue
+		}
+
+		if line == "/32 host LOCAL" && !seen[current] {
+			seen[current] = true
+			if ip := net.ParseIP(current).To4(); ip != nil && !ip.IsLoopback() {
+				addresses = append(addresses, ip)
+			}
+		}
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	routes, err := os.Open(filepath.Join(procNet, "route"))
+	if err != nil {
+		return nil, err
+	}
+	defer routes.Close()
+
+	scanner = bufio.NewScanner(routes)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) < 8 || fields[0] == "Iface" {
+			continue
+		}
+
+		destination, err1 := hexIPv4(fields[1])
+		mask, err2 := hexIPv4(fields[7])
+		if err1 != nil || err2 != nil || mask.Equal(net.IPv4zero.To4()) {
+			continue
+		}
+
+		subnet := net.IPNet{IP: destination, Mask: net.IPMask(mask)}
+		for _, ip := range addresses {
+			if _, ok := rv[fields[0]]; !ok && subnet.Contains(ip) {
+				rv[fields[0]] = service.Network{IPAddress: ip.String()}
+			}
+		}
+	}
+
+	return rv, scanner.Err()
+}
+
+// ipv6Interfaces returns the global IPv6 address of every interface from if_inet6.
+func ipv6Interfaces(procNet string) (map[string]string, error) {
+	rv := map[string]string{}
+
+	data, err := os.ReadFile(filepath.Join(procNet, "if_inet6"))
+	if os.IsNotExist(err) {
+		// IPv6 disabled
+		return rv, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) < 6 || fields[3] != "00" {
+			continue
+		}
+
+		address, err := hex.DecodeString(fields[0])
+		if err != nil || len(address) != net.IPv6len {
+			continue
+		}
+
+		if _, ok := rv[fields[5]]; !ok {
+			rv[fields[5]] = net.IP(address).String()
+		}
+	}
+
+	return rv, nil
+}
+
+// hexIPv4 decodes an address of /proc/net/route, in host byte order.
+func hexIPv4(value string) (net.IP, error) {
+	n, err := strconv.ParseUint(value, 16, 32)
+	if err != nil {
+		return nil, err
+	}
+
+	rv := make(net.IP, net.IPv4len)
+	binary.LittleEndian.PutUint32(rv, uint32(n))
+
+	return rv, nil
+}
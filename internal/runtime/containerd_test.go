@@ -0,0 +1,155 @@
+package runtime
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/containerd/containerd"
+	"github.com/containerd/containerd/containers"
+	"github.com/containerd/containerd/oci"
+	"github.com/njasm/clerk/internal/service"
+	specs "github.com/opencontainers/runtime-spec/specs-go"
+	"github.com/stretchr/testify/assert"
+)
+
+const testFibTrie = `Main:
+  +-- 0.0.0.0/0 3 0 5
+     |-- 0.0.0.0
+        /0 universe UNICAST
+     +-- 10.4.0.0/24 2 0 2
+        |-- 10.4.0.0
+           /24 link UNICAST
+        |-- 10.4.0.5
+           /32 host LOCAL
+     +-- 127.0.0.0/8 2 0 2
+        |-- 127.0.0.1
+           /32 host LOCAL
+     |-- 192.168.7.9
+        /32 host LOCAL
+Local:
+  +-- 0.0.0.0/0 3 0 5
+     |-- 10.4.0.5
+        /32 host LOCAL
+`
+
+const testRoute = `Iface	Destination	Gateway 	Flags	RefCnt	Use	Metric	Mask		MTU	Window	IRTT
+eth0	00000000	0100040A	0003	0	0	0	00000000	0	0	0
+eth0	0000040A	00000000	0001	0	0	0	00FFFFFF	0	0	0
+eth1	0007A8C0	00000000	0001	0	0	0	00FFFFFF	0	0	0
+`
+
+const testIfInet6 = `00000000000000000000000000000001 01 80 10 80       lo
+fe800000000000000000000000000002 02 40 20 80     eth0
+fd000000000000000000000000000005 02 40 00 00     eth0
+`
+
+func TestFromNerdctl(t *testing.T) {
+	c := fromNerdctl(containers.Container{
+		ID:    "abc123",
+		Image: "docker.io/library/nginx:1.25",
+		Labels: map[string]string{
+			nerdctlName:                       "web",
+			nerdctlHostname:                   "web-host",
+			nerdctlNetworks:                   `["bridge","backend"]`,
+			nerdctlPorts:                      `[{"HostPort":8080,"ContainerPort":80,"Protocol":"tcp","HostIP":"0.0.0.0"},{"HostPort":5353,"ContainerPort":53,"Protocol":"udp"}]`,
+			nerdctlIP:                         "10.4.0.10",
+			"com.github.njasm.clerk.register": "true",
+		},
+	}, &oci.Spec{Hostname: "abc123", Process: &specs.Process{Env: []string{"PORT=80"}}})
+
+	assert.Equal(t, "abc123", c.ID)
+	assert.Equal(t, "web", c.Name)
+	assert.Equal(t, "web-host", c.Hostname)
+	assert.Equal(t, "docker.io/library/nginx:1.25", c.Image)
+	assert.Equal(t, []string{"PORT=80"}, c.Env)
+	assert.Equal(t, "true", c.Labels["com.github.njasm.clerk.register"])
+	assert.Equal(t, []string{"53/udp", "80/tcp"}, c.ExposedPorts)
+	assert.Equal(t, map[string]int{"53/udp": 5353, "80/tcp": 8080}, c.PublishedPorts)
+	assert.Equal(t, map[string]service.Network{
+		"bridge":  {IPAddress: "10.4.0.10"},
+		"backend": {},
+	}, c.Networks)
+	assert.False(t, c.HostNetwork)
+
+	c = fromNerdctl(containers.Container{ID: "abc123", Labels: map[string]string{nerdctlNetworks: `["host"]`}}, nil)
+	assert.True(t, c.HostNetwork)
+}
+
+func TestFromNerdctlWithoutLabels(t *testing.T) {
+	c := fromNerdctl(containers.Container{ID: "abc123"}, nil)
+
+	assert.Equal(t, "abc123", c.Name)
+	assert.Empty(t, c.ExposedPorts)
+	assert.Empty(t, c.Networks)
+}
+
+func TestNetnsAddresses(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "fib_trie"), []byte(testFibTrie), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "route"), []byte(testRoute), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "if_inet6"), []byte(testIfInet6), 0644))
+
+	networks, err := netnsAddresses(dir, []string{"bridge", "backend"}, map[string]service.Network{
+		"bridge":  {},
+		"backend": {},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, map[string]service.Network{
+		"bridge":  {IPAddress: "10.4.0.5", GlobalIPv6Address: "fd00::5"},
+		"backend": {IPAddress: "192.168.7.9"},
+	}, networks)
+}
+
+func TestNetnsAddressesKeepsStaticAddress(t *testing.T) {
+	dir := t.TempDir()
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "fib_trie"), []byte(testFibTrie), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "route"), []byte(testRoute), 0644))
+
+	networks, err := netnsAddresses(dir, []string{"bridge"}, map[string]service.Network{
+		"bridge": {IPAddress: "10.4.0.10"},
+	})
+
+	assert.Nil(t, err)
+	assert.Equal(t, "10.4.0.10", networks["bridge"].IPAddress)
+	assert.Equal(t, "192.168.7.9", networks["eth1"].IPAddress)
+}
+
+// fakeTask is a task with a fixed pid and status.
+type fakeTask struct {
+	pid    uint32
+	status containerd.ProcessStatus
+}
+
+func (f fakeTask) Pid() uint32 { return f.pid }
+
+func (f fakeTask) Status(context.Context) (containerd.Status, error) {
+	return containerd.Status{Status: f.status}, nil
+}
+
+func TestTaskAddressesOfExitedTask(t *testing.T) {
+	proc := t.TempDir()
+	c := &Containerd{proc: proc}
+	networks := map[string]service.Network{"bridge": {IPAddress: "10.4.0.10"}}
+
+	// the task is still running, but its process is already gone
+	rv, err := c.taskAddresses(context.Background(), fakeTask{pid: 4242, status: containerd.Running}, []string{"bridge"}, networks)
+	assert.NoError(t, err)
+	assert.Equal(t, networks, rv)
+
+	// a stopped task isn't read, its pid may be another process
+	procNet := filepath.Join(proc, "4243", "net")
+	assert.Nil(t, os.MkdirAll(procNet, 0755))
+	assert.Nil(t, os.WriteFile(filepath.Join(procNet, "fib_trie"), []byte(testFibTrie), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(procNet, "route"), []byte(testRoute), 0644))
+
+	rv, err = c.taskAddresses(context.Background(), fakeTask{pid: 4243, status: containerd.Stopped}, []string{"bridge"}, networks)
+	assert.NoError(t, err)
+	assert.Equal(t, networks, rv)
+
+	rv, err = c.taskAddresses(context.Background(), fakeTask{pid: 4243, status: containerd.Running}, []string{"bridge"}, networks)
+	assert.NoError(t, err)
+	assert.Equal(t, "192.168.7.9", rv["eth1"].IPAddress)
+}
@@ -0,0 +1,209 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/filters"
+	docker "github.com/docker/docker/client"
+	"github.com/docker/go-connections/nat"
+	clerk "github.com/njasm/clerk/internal"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const (
+	dockerID = "docker"
+	podmanID = "podman"
+)
+
+const (
+	envPodmanHost = "CLERK_PODMAN_HOST"
+
+	defaultPodmanHost = "unix:///run/podman/podman.sock"
+)
+
+// DockerAPIClient is an interface that clients that talk with a docker server must implement.
+type DockerAPIClient interface {
+	docker.APIClient
+}
+
+func NewDocker() (clerk.Runtime, error) {
+	client, err := docker.NewClientWithOpts(docker.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("error creating docker runtime: %w", err)
+	}
+
+	return newDocker(dockerID, client), nil
+}
+
+// NewPodman talks to the Docker compatible API served by the Podman socket, the rootless
+// socket of the current user when XDG_RUNTIME_DIR is set and the system one otherwise.
+func NewPodman() (clerk.Runtime, error) {
+	host := defaultPodmanHost
+	if dir := os.Getenv("XDG_RUNTIME_DIR"); dir != "" && os.Geteuid() != 0 {
+		host = "unix://" + dir + "/podman/podman.sock"
+	}
+
+	client, err := docker.NewClientWithOpts(
+		docker.WithHost(utils.EnvOrDefault(envPodmanHost, host)),
+		docker.WithAPIVersionNegotiation(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error creating podman runtime: %w", err)
+	}
+
+	return newDocker(podmanID, client), nil
+}
+
+func newDocker(id string, client DockerAPIClient) *Docker {
+	return &Docker{id: id, client: client}
+}
+
+// Docker watches a Docker Engine, or any daemon serving the Docker API like Podman.
+type Docker struct {
+	id     string
+	client DockerAPIClient
+}
+
+func (d *Docker) ID() string {
+	return d.id
+}
+
+func (d *Docker) List(ctx context.Context) ([]string, error) {
+	containers, err := d.client.ContainerList(ctx, types.ContainerListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	rv := []string{}
+	for _, container := range containers {
+		rv = append(rv, container.ID)
+	}
+
+	return rv, nil
+}
+
+func (d *Docker) Inspect(ctx context.Context, containerID string) (service.Container, error) {
+	container, err := d.client.ContainerInspect(ctx, containerID)
+	if err != nil {
+		return service.Container{}, err
+	}
+
+	return fromDocker(container), nil
+}
+
+func (d *Docker) Events(ctx context.Context) (<-chan clerk.ContainerEvent, <-chan error) {
+	messages, errs := d.client.Events(ctx, types.EventsOptions{
+		Filters: filters.NewArgs(filters.Arg("type", "container")),
+	})
+
+	rv := make(chan clerk.ContainerEvent)
+	go func() {
+		for {
+			select {
+			case message := <-messages:
+				action := message.Action
+				if action == "" {
+					action = message.Status
+				}
+
+				// podman reports died where docker reports die
+				if action == "died" {
+					action = clerk.EVENT_DIE
+				}
+
+				select {
+				case rv <- clerk.ContainerEvent{ContainerID: message.Actor.ID, Action: action}:
+				case <-ctx.Done():
+					return
+				}
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	return rv, errs
+}
+
+func fromDocker(container types.ContainerJSON) service.Container {
+	rv := service.Container{
+		Labels:       map[string]string{},
+		Env:          []string{},
+		ExposedPorts: []string{},
+		Networks:     map[string]service.Network{},
+	}
+
+	if container.ContainerJSONBase != nil {
+		rv.ID = container.ID
+		rv.Name = strings.TrimLeft(container.Name, "/")
+	}
+
+	if container.Config != nil {
+		rv.Hostname = container.Config.Hostname
+		rv.Image = container.Config.Image
+		rv.Env = append(rv.Env, container.Config.Env...)
+		for key, value := range container.Config.Labels {
+			rv.Labels[key] = value
+		}
+
+		for port := range container.Config.ExposedPorts {
+			rv.ExposedPorts = append(rv.ExposedPorts, string(port))
+		}
+
+		sort.Strings(rv.ExposedPorts)
+	}
+
+	if container.ContainerJSONBase != nil && container.HostConfig != nil {
+		rv.HostNetwork = container.HostConfig.NetworkMode.IsHost()
+	}
+
+	// the bindings of a container that isn't running aren't in its network settings
+	if container.NetworkSettings != nil && len(container.NetworkSettings.Ports) > 0 {
+		rv.PublishedPorts = publishedPorts(container.NetworkSettings.Ports)
+	} else if container.ContainerJSONBase != nil && container.HostConfig != nil {
+		rv.PublishedPorts = publishedPorts(container.HostConfig.PortBindings)
+	}
+
+	if container.NetworkSettings != nil {
+		for name, settings := range container.NetworkSettings.Networks {
+			if settings == nil {
+				continue
+			}
+
+			rv.Networks[name] = service.Network{
+				IPAddress:         settings.IPAddress,
+				GlobalIPv6Address: settings.GlobalIPv6Address,
+			}
+		}
+	}
+
+	return rv
+}
+
+// publishedPorts returns the first host port of every port binding, bindings to a
+// loopback address are only reachable from the host and are left out.
+func publishedPorts(bindings nat.PortMap) map[string]int {
+	rv := map[string]int{}
+	for port, portBindings := range bindings {
+		for _, binding := range portBindings {
+			if ip := net.ParseIP(binding.HostIP); ip != nil && ip.IsLoopback() {
+				continue
+			}
+
+			if hostPort, err := strconv.Atoi(binding.HostPort); err == nil && hostPort > 0 {
+				rv[string(port)] = hostPort
+				break
+			}
+		}
+	}
+
+	return rv
+}
@@ -0,0 +1,98 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/container"
+	"github.com/docker/docker/api/types/network"
+	"github.com/docker/go-connections/nat"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFromDocker(t *testing.T) {
+	c := fromDocker(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{ID: "abc123", Name: "/web"},
+		Config: &container.Config{
+			Hostname:     "host",
+			Image:        "nginx:1.25",
+			Env:          []string{"PORT=80"},
+			Labels:       map[string]string{"com.github.njasm.clerk.register": "true"},
+			ExposedPorts: nat.PortSet{"443/tcp": struct{}{}, "80/tcp": struct{}{}},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{
+				"bridge": {IPAddress: "10.0.0.2", GlobalIPv6Address: "fd00::2"},
+				"broken": nil,
+			},
+		},
+	})
+
+	assert.Equal(t, "abc123", c.ID)
+	assert.Equal(t, "web", c.Name)
+	assert.Equal(t, "host", c.Hostname)
+	assert.Equal(t, "nginx:1.25", c.Image)
+	assert.Equal(t, []string{"PORT=80"}, c.Env)
+	assert.Equal(t, "true", c.Labels["com.github.njasm.clerk.register"])
+	assert.Equal(t, []string{"443/tcp", "80/tcp"}, c.ExposedPorts)
+	assert.Equal(t, map[string]service.Network{"bridge": {IPAddress: "10.0.0.2", GlobalIPv6Address: "fd00::2"}}, c.Networks)
+}
+
+func TestFromDockerWithoutDetails(t *testing.T) {
+	c := fromDocker(types.ContainerJSON{})
+
+	assert.Equal(t, "", c.ID)
+	assert.Empty(t, c.ExposedPorts)
+	assert.Empty(t, c.Networks)
+}
+
+func TestFromDockerHostNetwork(t *testing.T) {
+	c := fromDocker(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID:         "abc123",
+			Name:       "/web",
+			HostConfig: &container.HostConfig{NetworkMode: "host"},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			Networks: map[string]*network.EndpointSettings{"host": {}},
+		},
+	})
+
+	assert.True(t, c.HostNetwork)
+	assert.Equal(t, map[string]service.Network{"host": {}}, c.Networks)
+}
+
+func TestFromDockerPublishedPorts(t *testing.T) {
+	c := fromDocker(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: "abc123",
+			HostConfig: &container.HostConfig{PortBindings: nat.PortMap{
+				"80/tcp": {{HostPort: "9090"}},
+			}},
+		},
+		NetworkSettings: &types.NetworkSettings{
+			NetworkSettingsBase: types.NetworkSettingsBase{Ports: nat.PortMap{
+				"80/tcp":   {{HostIP: "0.0.0.0", HostPort: "8080"}, {HostIP: "::", HostPort: "8080"}},
+				"443/tcp":  {{HostIP: "127.0.0.1", HostPort: "8443"}},
+				"53/udp":   {{HostIP: "0.0.0.0", HostPort: "5353"}},
+				"9000/tcp": nil,
+			}},
+		},
+	})
+
+	assert.Equal(t, map[string]int{"80/tcp": 8080, "53/udp": 5353}, c.PublishedPorts)
+
+	// a stopped container only has the bindings of its host config
+	c = fromDocker(types.ContainerJSON{
+		ContainerJSONBase: &types.ContainerJSONBase{
+			ID: "abc123",
+			HostConfig: &container.HostConfig{PortBindings: nat.PortMap{
+				"80/tcp": {{HostPort: "8080"}},
+			}},
+		},
+		NetworkSettings: &types.NetworkSettings{},
+	})
+
+	assert.Equal(t, map[string]int{"80/tcp": 8080}, c.PublishedPorts)
+}
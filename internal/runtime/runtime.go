@@ -0,0 +1,27 @@
+package runtime
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	clerk "github.com/njasm/clerk/internal"
+)
+
+var ErrUnknownRuntime = errors.New("unknown container runtime")
+
+// New creates the container runtime identified by id.
+func New(id string) (clerk.Runtime, error) {
+	switch strings.ToLower(strings.TrimSpace(id)) {
+	case dockerID:
+		return NewDocker()
+	case swarmID:
+		return NewSwarm()
+	case podmanID:
+		return NewPodman()
+	case containerdID:
+		return NewContainerd()
+	}
+
+	return nil, fmt.Errorf("%w: %s", ErrUnknownRuntime, id)
+}
@@ -0,0 +1,12 @@
+package runtime
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewUnknownRuntime(t *testing.T) {
+	_, err := New("rkt")
+	assert.ErrorIs(t, err, ErrUnknownRuntime)
+}
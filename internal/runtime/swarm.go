@@ -0,0 +1,202 @@
+package runtime
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/docker/docker/client"
+	clerk "github.com/njasm/clerk/internal"
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const swarmID = "swarm"
+
+const (
+	envSwarmManagerHost = "CLERK_SWARM_MANAGER_HOST"
+	envSwarmPublish     = "CLERK_SWARM_PUBLISH"
+
+	swarmPublishOverlay = "overlay"
+	swarmPublishIngress = "ingress"
+
+	swarmIngressNetwork = "ingress"
+)
+
+func NewSwarm() (clerk.Runtime, error) {
+	publish := strings.ToLower(utils.EnvOrDefault(envSwarmPublish, swarmPublishOverlay))
+	if publish != swarmPublishOverlay && publish != swarmPublishIngress {
+		return nil, fmt.Errorf("error creating swarm runtime: %s must be %s or %s", envSwarmPublish, swarmPublishOverlay, swarmPublishIngress)
+	}
+
+	client, err := docker.NewClientWithOpts(docker.FromEnv)
+	if err != nil {
+		return nil, fmt.Errorf("error creating swarm runtime: %w", err)
+	}
+
+	// services can only be inspected on a manager, workers point to one
+	manager := client
+	if host := utils.EnvOrDefault(envSwarmManagerHost, ""); host != "" {
+		manager, err = docker.NewClientWithOpts(docker.FromEnv, docker.WithHost(host))
+		if err != nil {
+			return nil, fmt.Errorf("error creating swarm runtime: %w", err)
+		}
+	}
+
+	return newSwarm(client, manager, publish), nil
+}
+
+func newSwarm(client, manager DockerAPIClient, publish string) *Swarm {
+	return &Swarm{
+		Docker:   newDocker(swarmID, client),
+		manager:  manager,
+		publish:  publish,
+		services: map[string]swarm.Service{},
+	}
+}
+
+// Swarm watches the local containers of a Docker Swarm node. Containers of a Swarm task
+// are described with the labels of their service spec, named after their service, and
+// registered with their overlay network addresses or, in ingress mode, with the node
+// address and the ports published on the routing mesh.
+type Swarm struct {
+	*Docker
+	manager DockerAPIClient
+	publish string
+
+	mu       sync.Mutex
+	nodeAddr string
+	// last known spec of every service, to describe the tasks of a removed service
+	services map[string]swarm.Service
+}
+
+func (s *Swarm) Inspect(ctx context.Context, containerID string) (service.Container, error) {
+	container, err := s.Docker.Inspect(ctx, containerID)
+	if err != nil {
+		return container, err
+	}
+
+	serviceID := container.Labels[constants.SWARM_SERVICE_ID]
+	if serviceID == "" {
+		return container, nil
+	}
+
+	spec, err := s.service(ctx, serviceID)
+	if err != nil {
+		return container, err
+	}
+
+	publish := s.publish
+	publishLabel := service.LabelPrefix() + strings.TrimPrefix(constants.CONFIG_SWARM_PUBLISH, constants.CONFIG_PREFIX)
+	if value, ok := label(spec.Spec.Labels, publishLabel); ok {
+		publish = strings.ToLower(strings.TrimSpace(value))
+	}
+
+	nodeAddr, advertised := "", false
+	if publish == swarmPublishIngress {
+		if nodeAddr, advertised, err = s.node(ctx); err != nil {
+			return container, err
+		}
+	}
+
+	container = fromSwarm(container, spec, publish, nodeAddr)
+	container.Advertised = advertised
+
+	return container, nil
+}
+
+func (s *Swarm) service(ctx context.Context, serviceID string) (swarm.Service, error) {
+	spec, _, err := s.manager.ServiceInspectWithRaw(ctx, serviceID, types.ServiceInspectOptions{})
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err != nil {
+		if cached, ok := s.services[serviceID]; ok {
+			return cached, nil
+		}
+
+		return spec, fmt.Errorf("swarm: inspecting service %s: %w", serviceID, err)
+	}
+
+	s.services[serviceID] = spec
+	return spec, nil
+}
+
+// node returns the address of this node in the swarm, or the advertise address when
+// one is configured, and whether it is the advertise address.
+func (s *Swarm) node(ctx context.Context) (string, bool, error) {
+	if advertised, err := service.Advertise(); err == nil && advertised.Source != service.ADVERTISE_DEFAULT_ROUTE {
+		return advertised.Address(), true, nil
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.nodeAddr != "" {
+		return s.nodeAddr, false, nil
+	}
+
+	info, err := s.client.Info(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	if info.Swarm.NodeAddr == "" {
+		return "", false, fmt.Errorf("swarm: node is not part of a swarm")
+	}
+
+	s.nodeAddr = info.Swarm.NodeAddr
+	return s.nodeAddr, false, nil
+}
+
+// fromSwarm completes the description of the container of a task of spec. Labels of the
+// container take precedence over the ones of the service.
+func fromSwarm(container service.Container, spec swarm.Service, publish, nodeAddr string) service.Container {
+	for key, value := range spec.Spec.Labels {
+		if _, ok := container.Labels[key]; !ok {
+			container.Labels[key] = value
+		}
+	}
+
+	if name := container.Labels[constants.SWARM_SERVICE_NAME]; name != "" {
+		container.Name = name
+	}
+
+	// the routing mesh address of a task isn't reachable from outside
+	delete(container.Networks, swarmIngressNetwork)
+	if publish != swarmPublishIngress {
+		return container
+	}
+
+	ports := []string{}
+	for _, port := range spec.Endpoint.Ports {
+		if port.PublishMode == swarm.PortConfigPublishModeIngress && port.PublishedPort != 0 {
+			ports = append(ports, fmt.Sprintf("%d/%s", port.PublishedPort, port.Protocol))
+		}
+	}
+
+	sort.Strings(ports)
+	container.ExposedPorts = ports
+	container.Networks = map[string]service.Network{
+		swarmIngressNetwork: {IPAddress: nodeAddr},
+	}
+
+	return container
+}
+
+// label returns the value of key, label keys being case insensitive.
+func label(labels map[string]string, key string) (string, bool) {
+	for k, v := range labels {
+		if strings.EqualFold(strings.TrimSpace(k), key) {
+			return v, true
+		}
+	}
+
+	return "", false
+}
@@ -0,0 +1,118 @@
+package runtime
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/docker/docker/api/types"
+	"github.com/docker/docker/api/types/swarm"
+	docker "github.com/docker/docker/client"
+	"github.com/njasm/clerk/internal/service"
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeManager answers service inspects with services, or with an error for unknown ones.
+type fakeManager struct {
+	docker.APIClient
+	services map[string]swarm.Service
+}
+
+func (m *fakeManager) ServiceInspectWithRaw(_ context.Context, serviceID string, _ types.ServiceInspectOptions) (swarm.Service, []byte, error) {
+	if spec, ok := m.services[serviceID]; ok {
+		return spec, nil, nil
+	}
+
+	return swarm.Service{}, nil, errors.New("service not found")
+}
+
+func newTestTask(taskID string) service.Container {
+	return service.Container{
+		ID:       "c-" + taskID,
+		Name:     "web.1." + taskID,
+		Hostname: "c-" + taskID,
+		Labels: map[string]string{
+			"com.docker.swarm.service.id":   "svc1",
+			"com.docker.swarm.service.name": "stack_web",
+			"com.docker.swarm.task.id":      taskID,
+			"com.github.njasm.clerk.tags":   "from-container",
+		},
+		ExposedPorts: []string{"80/tcp"},
+		Networks: map[string]service.Network{
+			"ingress":       {IPAddress: "10.0.0.7"},
+			"stack_backend": {IPAddress: "10.0.1.7"},
+		},
+	}
+}
+
+func newTestSwarmService() swarm.Service {
+	spec := swarm.Service{ID: "svc1"}
+	spec.Spec.Labels = map[string]string{
+		"com.github.njasm.clerk.register": "true",
+		"com.github.njasm.clerk.tags":     "from-service",
+	}
+	spec.Endpoint.Ports = []swarm.PortConfig{
+		{Protocol: swarm.PortConfigProtocolTCP, TargetPort: 80, PublishedPort: 8080, PublishMode: swarm.PortConfigPublishModeIngress},
+		{Protocol: swarm.PortConfigProtocolTCP, TargetPort: 81, PublishedPort: 8081, PublishMode: swarm.PortConfigPublishModeHost},
+	}
+
+	return spec
+}
+
+func TestFromSwarmOverlay(t *testing.T) {
+	c := fromSwarm(newTestTask("task1"), newTestSwarmService(), swarmPublishOverlay, "")
+	srv := service.NewFrom(c)
+
+	assert.Equal(t, "stack_web", srv.Name())
+	policy, err := service.NewPolicy()
+	assert.NoError(t, err)
+	assert.True(t, policy.Register(srv))
+	assert.Equal(t, []string{"from-container"}, srv.Tags())
+	assert.Equal(t, map[string]service.Instance{
+		"stack_web:tcp:80:task1": {ID: "stack_web:tcp:80:task1", Name: "stack_web", IP: "10.0.1.7", Port: 80, Proto: "tcp"},
+	}, srv.Instances())
+}
+
+func TestFromSwarmIngress(t *testing.T) {
+	c := fromSwarm(newTestTask("task1"), newTestSwarmService(), swarmPublishIngress, "192.168.1.10")
+	srv := service.NewFrom(c)
+
+	assert.Equal(t, map[string]service.Instance{
+		"stack_web:tcp:8080:task1": {ID: "stack_web:tcp:8080:task1", Name: "stack_web", IP: "192.168.1.10", Port: 8080, Proto: "tcp"},
+	}, srv.Instances())
+}
+
+func TestFromSwarmRescheduledTask(t *testing.T) {
+	before := service.NewFrom(fromSwarm(newTestTask("task1"), newTestSwarmService(), swarmPublishOverlay, ""))
+	after := service.NewFrom(fromSwarm(newTestTask("task2"), newTestSwarmService(), swarmPublishOverlay, ""))
+
+	assert.NotEqual(t, before.ID(), after.ID())
+}
+
+func TestSwarmServiceKeepsLastKnownSpec(t *testing.T) {
+	manager := &fakeManager{services: map[string]swarm.Service{"svc1": newTestSwarmService()}}
+	s := newSwarm(nil, manager, swarmPublishOverlay)
+
+	spec, err := s.service(context.Background(), "svc1")
+	assert.Nil(t, err)
+	assert.Equal(t, "svc1", spec.ID)
+
+	// the service is removed while its tasks are still being stopped
+	delete(manager.services, "svc1")
+	spec, err = s.service(context.Background(), "svc1")
+	assert.Nil(t, err)
+	assert.Equal(t, "svc1", spec.ID)
+
+	_, err = s.service(context.Background(), "svc2")
+	assert.NotNil(t, err)
+}
+
+func TestSwarmNodeAdvertiseAddress(t *testing.T) {
+	t.Setenv("CLERK_ADVERTISE_ADDRESS", "192.168.1.20")
+	s := newSwarm(nil, nil, swarmPublishIngress)
+
+	addr, advertised, err := s.node(context.Background())
+	assert.NoError(t, err)
+	assert.True(t, advertised)
+	assert.Equal(t, "192.168.1.20", addr)
+}
@@ -9,10 +9,6 @@ import (
 	"sync"
 	"time"
 
-	"github.com/docker/docker/api/types"
-	"github.com/docker/docker/api/types/events"
-	"github.com/docker/docker/api/types/filters"
-	dockerapi "github.com/docker/docker/client"
 	"github.com/njasm/clerk/internal/service"
 	"github.com/njasm/clerk/internal/utils"
 )
@@ -95,81 +91,89 @@ func trackRegisteredServices(chMessage <-chan *TrackMessage, stopServer <-chan b
 }
 
 type Server struct {
-	dockerClient          DockerAPIClient
-	dockerMessagesChannel <-chan events.Message
-	dockerErrorChannel    <-chan error
-	stopServerChannel     <-chan bool
-	registry              Registry
-	trackServicesChannel  chan<- *TrackMessage
+	runtime              Runtime
+	eventsChannel        <-chan ContainerEvent
+	errorChannel         <-chan error
+	stopServerChannel    <-chan bool
+	registry             Registry
+	policy               *service.Policy
+	advertiser           *service.Advertiser
+	advertiseChannel     chan service.Advertised
+	trackServicesChannel chan<- *TrackMessage
+	// collected is set once the registries removed what a previous run left behind
+	collected bool
 }
 
-func New(stopServer <-chan bool, registry Registry) (*Server, error) {
-	client, err := dockerapi.NewClientWithOpts(dockerapi.FromEnv)
+func New(stopServer <-chan bool, registry Registry, runtime Runtime) (*Server, error) {
+	policy, err := service.NewPolicy()
 	if err != nil {
 		return nil, err
 	}
 
-	chMessages, chErrors := client.Events(context.TODO(), types.EventsOptions{
-		Filters: filters.NewArgs(
-			filters.KeyValuePair{
-				Key: "Type", Value: "container",
-			},
-		),
-	})
+	advertiser, err := service.NewAdvertiser()
+	if err != nil {
+		return nil, err
+	}
+
+	service.SetAdvertiser(advertiser)
+
+	chMessages, chErrors := runtime.Events(context.TODO())
 
 	chTrack := make(chan *TrackMessage, 64)
 
 	go trackRegisteredServices(chTrack, stopServer)
 
 	return &Server{
-		dockerClient:          client,
-		dockerMessagesChannel: chMessages,
-		dockerErrorChannel:    chErrors,
-		stopServerChannel:     stopServer,
-		registry:              registry,
-		trackServicesChannel:  chTrack,
+		runtime:              runtime,
+		eventsChannel:        chMessages,
+		errorChannel:         chErrors,
+		stopServerChannel:    stopServer,
+		registry:             registry,
+		policy:               policy,
+		advertiser:           advertiser,
+		advertiseChannel:     make(chan service.Advertised, 1),
+		trackServicesChannel: chTrack,
 	}, nil
 }
 
 func (s *Server) Start() {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go s.advertiser.Watch(ctx, func(advertised service.Advertised) {
+		select {
+		case s.advertiseChannel <- advertised:
+		default:
+		}
+	})
 
 	timer := time.NewTicker(time.Second * 2)
 	for {
 		select {
-		case data := <-s.dockerMessagesChannel:
+		case data := <-s.eventsChannel:
 
-			fmt.Printf("Event ID: %+v\n", data.ID)
-			fmt.Printf("Status  : %+v\n", data.Status)
-			fmt.Printf("Scope   : %+v\n", data.Scope)
-			fmt.Printf("Type    : %+v\n", data.Type)
-			fmt.Printf("From    : %+v\n", data.From)
+			fmt.Printf("Runtime : %+v\n", s.runtime.ID())
 			fmt.Printf("Action  : %+v\n", data.Action)
-			fmt.Printf("Actor ID: %+v\n", data.Actor.ID)
-			fmt.Println("A. Attrb:")
-
-			for k, v := range data.Actor.Attributes {
-				fmt.Printf(" - %+v : %+v\n", k, v)
-			}
-
+			fmt.Printf("Actor ID: %+v\n", data.ContainerID)
 			println()
 
-			if data.Status == "start" && data.Type == "container" {
-				err := s.register(data.Actor.ID)
+			if data.Action == EVENT_START {
+				err := s.register(data.ContainerID)
 				if err != nil {
 					err = fmt.Errorf("error: %w", err)
 					fmt.Println(err)
 				}
 			}
 
-			if data.Status == "die" && data.Type == "container" {
-				err := s.unregister(data.Actor.ID)
+			if data.Action == EVENT_DIE {
+				err := s.unregister(data.ContainerID)
 				if err != nil {
 					err = fmt.Errorf("error: %w", err)
 					log.Println(err)
 				}
 			}
 
-		case e := <-s.dockerErrorChannel:
+		case e := <-s.errorChannel:
 
 			err := fmt.Errorf("error: %w", e)
 			fmt.Println(err)
@@ -178,7 +182,7 @@ func (s *Server) Start() {
 
 			fmt.Println("TIMER TICK - SYNCHRONIZATION")
 
-			containers, err := s.dockerClient.ContainerList(context.Background(), types.ContainerListOptions{})
+			containers, err := s.runtime.List(context.Background())
 			if err != nil {
 				err = fmt.Errorf("error: %w", err)
 				fmt.Println(err)
@@ -191,6 +195,20 @@ func (s *Server) Start() {
 				fmt.Println(err)
 			}
 
+			if !s.collected {
+				s.collected = s.collect() == nil
+			}
+
+		case advertised := <-s.advertiseChannel:
+
+			fmt.Printf("ADVERTISE ADDRESS CHANGED: %s\n", advertised.Address())
+
+			err := s.readvertise()
+			if err != nil {
+				err = fmt.Errorf("error: %w", err)
+				fmt.Println(err)
+			}
+
 		case <-s.stopServerChannel:
 
 			//TODO: teardown gracefully everywere
@@ -214,11 +232,19 @@ func (s *Server) register(containerID string) error {
 		return err
 	}
 
-	if !service.Register() {
+	for _, err := range service.Errors() {
+		log.Println(fmt.Errorf("container %s: %w", containerID, err))
+	}
+
+	for _, diagnostic := range service.Diagnostics() {
+		log.Printf("container %s: %s\n", containerID, diagnostic)
+	}
+
+	if !s.policy.Register(service) {
 		return nil
 	}
 
-	err = s.registry.Register(service)
+	err = s.registry.Register(service.Addressed())
 	if err != nil {
 		log.Println(fmt.Errorf("error registering service: %w", err))
 		err = nil
@@ -246,16 +272,80 @@ func (s *Server) unregister(containerID string) error {
 	return nil
 }
 
+// readvertise registers again the containers registered with the advertise address,
+// like host network containers and Swarm tasks published on the routing mesh.
+func (s *Server) readvertise() error {
+	containers, err := s.runtime.List(context.Background())
+	if err != nil {
+		return err
+	}
+
+	for _, containerID := range containers {
+		srv, err := s.containerToService(containerID)
+		if err != nil || !srv.Advertised() {
+			continue
+		}
+
+		if err := s.register(containerID); err != nil {
+			log.Println(fmt.Errorf("error: %w", err))
+		}
+	}
+
+	return nil
+}
+
+// collect runs the collectors among the registries, after the first synchronisation
+// registered the running containers.
+func (s *Server) collect() error {
+	var rv error
+	for _, registry := range s.registries() {
+		collector, ok := registry.(Collector)
+		if !ok {
+			continue
+		}
+
+		if err := collector.Collect(); err != nil {
+			rv = fmt.Errorf("error collecting registry %s: %w", registry.ID(), err)
+			fmt.Println(rv)
+		}
+	}
+
+	return rv
+}
+
+// registerInto registers an already tracked container into a single registry.
+func (s *Server) registerInto(registry Registry, containerID string) error {
+	service, err := s.containerToService(containerID)
+	if err != nil {
+		return err
+	}
+
+	if !s.policy.Register(service) {
+		return nil
+	}
+
+	return registry.Register(service.Addressed())
+}
+
+// registries returns every registry to reconcile, the backends of a MultiRegistry one by one.
+func (s *Server) registries() []Registry {
+	if multi, ok := s.registry.(MultiRegistry); ok {
+		return multi.Registries()
+	}
+
+	return []Registry{s.registry}
+}
+
 func (s *Server) containerToService(containerID string) (*service.Service, error) {
-	containerJson, err := s.dockerClient.ContainerInspect(context.TODO(), containerID)
+	container, err := s.runtime.Inspect(context.TODO(), containerID)
 	if err != nil {
 		return nil, err
 	}
 
-	return service.NewFrom(containerJson), nil
+	return service.NewFrom(container), nil
 }
 
-func (s *Server) synchronise(containers []types.Container) error {
+func (s *Server) synchronise(containers []string) error {
 	if len(containers) == 0 {
 		return nil
 	}
@@ -273,9 +363,9 @@ func (s *Server) synchronise(containers []types.Container) error {
 	// TODO: we need to simplify this piece of code, we're doing too much here
 	tracked := map[ServiceID]ContainerID{}
 	var group sync.WaitGroup
-	for _, container := range containers {
-		containerID := ContainerID(container.ID)
-		srv, err := s.containerToService(container.ID)
+	for _, id := range containers {
+		containerID := ContainerID(id)
+		srv, err := s.containerToService(id)
 		if err != nil {
 			continue
 		}
@@ -300,51 +390,47 @@ func (s *Server) synchronise(containers []types.Container) error {
 				}
 
 				wg.Done()
-			}(s, container.ID, &group)
+			}(s, id, &group)
 
 			break
 		}
 	}
 
-	services, err := s.registry.Services()
-	if err != nil {
-		err = fmt.Errorf("error getting services from registry: %w", err)
-		fmt.Println(err)
-		return err
-	}
-
-	registeredContainer := map[ContainerID]bool{}
+	var rv error
 	mapperFn := func(v *service.RegisteredService) string { return v.ID }
-	// and its still registered in the registry?
-	for _, cID := range tracked {
-		if _, exists := registeredContainer[cID]; exists {
+	// and its still registered in every registry?
+	for _, registry := range s.registries() {
+		services, err := registry.Services()
+		if err != nil {
+			rv = fmt.Errorf("error getting services from registry %s: %w", registry.ID(), err)
+			fmt.Println(rv)
 			continue
 		}
 
-		for _, id := range utils.Map(services, mapperFn) {
-			if _, exists := tracked[ServiceID(id)]; exists {
+		registered := utils.Map(services, mapperFn)
+		reconciled := map[ContainerID]bool{}
+		for serviceID, cID := range tracked {
+			if reconciled[cID] || utils.Any(registered, string(serviceID)) {
 				continue
 			}
 
-			registeredContainer[cID] = true
+			reconciled[cID] = true
 			group.Add(1)
-			go func(s *Server, id string, wg *sync.WaitGroup) {
-				err := s.register(id)
+			go func(s *Server, r Registry, id string, wg *sync.WaitGroup) {
+				err := s.registerInto(r, id)
 				if err != nil {
-					err = fmt.Errorf("error: %w", err)
+					err = fmt.Errorf("error: %s: %w", r.ID(), err)
 					fmt.Println(err)
 				}
 
 				wg.Done()
-			}(s, string(cID), &group)
-
-			break
+			}(s, registry, string(cID), &group)
 		}
 	}
 
 	group.Wait()
 
-	return nil
+	return rv
 }
 
 func ExitOnError(e error) {
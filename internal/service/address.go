@@ -0,0 +1,159 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const envAddressFamily = "CLERK_ADDRESS_FAMILY"
+
+// Address families registered for the containers of dual-stack networks. FAMILY_BOTH
+// registers an IPv4 and an IPv6 instance, the IPv6 one with an :ipv6 suffixed ID, while
+// FAMILY_DUAL registers a single IPv4 instance with its IPv6 address as tagged address.
+const (
+	FAMILY_IPV4 = "ipv4"
+	FAMILY_IPV6 = "ipv6"
+	FAMILY_BOTH = "both"
+	FAMILY_DUAL = "dual"
+)
+
+var ErrAddress = errors.New("address error")
+
+// addressFamily returns the family of the container label, or the global one.
+func (s *Service) addressFamily() string {
+	family, ok := s.GetConfig(constants.CONFIG_ADDRESS_FAMILY)
+	if !ok {
+		family = utils.EnvOrDefault(envAddressFamily, FAMILY_IPV4)
+	}
+
+	switch family = trimAndLowerString(family); family {
+	case FAMILY_IPV4, FAMILY_IPV6, FAMILY_BOTH, FAMILY_DUAL:
+		return family
+	}
+
+	s.errors = append(s.errors, fmt.Errorf("%w: unknown address family %q, using %s", ErrAddress, family, FAMILY_IPV4))
+	return FAMILY_IPV4
+}
+
+// addresses returns the first IPv4 and the first IPv6 address of the container networks,
+// in network name order.
+func (s *Service) addresses() (string, string) {
+	names := make([]string, 0, len(s.container.Networks))
+	for name := range s.container.Networks {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+	ipv4, ipv6 := "", ""
+	for _, name := range names {
+		network := s.container.Networks[name]
+		if ipv4 == "" {
+			ipv4 = network.IPAddress
+		}
+
+		if ipv6 == "" {
+			ipv6 = network.GlobalIPv6Address
+		}
+	}
+
+	return ipv4, ipv6
+}
+
+// addInstances adds the instances of template for the address family of the service.
+func (s *Service) addInstances(template Instance) {
+	if len(s.container.Networks) == 0 && !s.container.HostNetwork {
+		return
+	}
+
+	ipv4, ipv6 := "", ""
+	if !s.container.HostNetwork {
+		ipv4, ipv6 = s.addresses()
+	}
+
+	// without a routable address of its own the container is registered with the host one
+	if !routable(ipv4) && !routable(ipv6) {
+		if host, err := s.advertiseAddresses(); err == nil {
+			ipv4, ipv6 = host.IPv4, host.IPv6
+			s.advertised = true
+		}
+	}
+	// registered with the address of the host, or it would be
+	hostAddress := s.advertised || s.container.HostNetwork
+
+	// on the host address the port is the one the host publishes it on
+	if s.advertised {
+		if port, ok := s.container.PublishedPorts[fmt.Sprintf("%d/%s", template.Port, template.Proto)]; ok {
+			template.Port = port
+		}
+	}
+
+	add := func(instance Instance) {
+		// the service ID is the first instance ID, with an address when there is one
+		if current, ok := s.instances[s.id]; !ok || (current.missing && !instance.missing) {
+			s.id = instance.ID
+		}
+
+		s.instances[instance.ID] = instance
+	}
+
+	// an instance without address is kept, so a container that lost its address when it
+	// died still unregisters it, but it is never registered
+	missing := func(instance Instance, family string) {
+		s.errors = append(s.errors, fmt.Errorf("%w: %s: no %s address", ErrAddress, instance.ID, family))
+		instance.missing = true
+		add(instance)
+	}
+
+	switch s.family {
+	case FAMILY_IPV6:
+		if ipv6 == "" {
+			missing(template, "IPv6")
+			return
+		}
+
+		template.IP = ipv6
+		add(template)
+	case FAMILY_BOTH:
+		ipv4Instance := template
+		ipv4Instance.IP = ipv4
+		if ipv4 == "" {
+			missing(ipv4Instance, "IPv4")
+		} else {
+			add(ipv4Instance)
+		}
+
+		template.ID += ":" + FAMILY_IPV6
+		if ipv6 == "" {
+			missing(template, "IPv6")
+			return
+		}
+
+		template.IP = ipv6
+		add(template)
+	case FAMILY_DUAL:
+		template.IP, template.IPv6 = ipv4, ipv6
+		if ipv4 == "" {
+			template.IP, template.IPv6 = ipv6, ""
+		}
+
+		if hostAddress && template.IP == "" {
+			missing(template, "IP")
+			return
+		}
+
+		add(template)
+	default:
+		// a container network without address is still registered, the host has to have one
+		if hostAddress && ipv4 == "" {
+			missing(template, "IPv4")
+			return
+		}
+
+		template.IP = ipv4
+		add(template)
+	}
+}
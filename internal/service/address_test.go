@@ -0,0 +1,116 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newDualStackContainer(labels map[string]string) Container {
+	return Container{
+		Name:         "web",
+		Hostname:     "host",
+		Labels:       labels,
+		ExposedPorts: []string{"80/tcp"},
+		Networks: map[string]Network{
+			"frontend": {IPAddress: "10.0.1.2", GlobalIPv6Address: "fd00:1::2"},
+			"backend":  {IPAddress: "10.0.0.2", GlobalIPv6Address: "fd00::2"},
+		},
+	}
+}
+
+func TestAddressFamily(t *testing.T) {
+	scenarios := map[string]map[string]Instance{
+		FAMILY_IPV4: {
+			"web:tcp:80:host": {ID: "web:tcp:80:host", Name: "web", IP: "10.0.0.2", Port: 80, Proto: "tcp"},
+		},
+		FAMILY_IPV6: {
+			"web:tcp:80:host": {ID: "web:tcp:80:host", Name: "web", IP: "fd00::2", Port: 80, Proto: "tcp"},
+		},
+		FAMILY_BOTH: {
+			"web:tcp:80:host":      {ID: "web:tcp:80:host", Name: "web", IP: "10.0.0.2", Port: 80, Proto: "tcp"},
+			"web:tcp:80:host:ipv6": {ID: "web:tcp:80:host:ipv6", Name: "web", IP: "fd00::2", Port: 80, Proto: "tcp"},
+		},
+		FAMILY_DUAL: {
+			"web:tcp:80:host": {ID: "web:tcp:80:host", Name: "web", IP: "10.0.0.2", Port: 80, Proto: "tcp", IPv6: "fd00::2"},
+		},
+	}
+
+	for family, expected := range scenarios {
+		t.Run(family, func(t *testing.T) {
+			srv := NewFrom(newDualStackContainer(map[string]string{"com.github.njasm.clerk.address.family": family}))
+			assert.Equal(t, expected, srv.Instances())
+			assert.Equal(t, "web:tcp:80:host", srv.ID())
+			assert.Empty(t, srv.Errors())
+		})
+	}
+}
+
+func TestAddressFamilyGlobal(t *testing.T) {
+	t.Setenv(envAddressFamily, FAMILY_IPV6)
+
+	srv := NewFrom(newDualStackContainer(nil))
+	assert.Equal(t, "fd00::2", srv.IPAddress())
+
+	// the label wins over the global setting
+	srv = NewFrom(newDualStackContainer(map[string]string{"com.github.njasm.clerk.address.family": "IPv4"}))
+	assert.Equal(t, "10.0.0.2", srv.IPAddress())
+}
+
+func TestAddressFamilyWithoutIPv6(t *testing.T) {
+	container := newDualStackContainer(map[string]string{"com.github.njasm.clerk.address.family": FAMILY_IPV6})
+	container.Networks = map[string]Network{"bridge": {IPAddress: "10.0.0.2"}}
+
+	srv := NewFrom(container)
+	assert.Empty(t, srv.Addressed().Instances())
+	assert.Contains(t, srv.Instances(), "web:tcp:80:host")
+	assert.Len(t, srv.Errors(), 1)
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+}
+
+func TestAddressFamilyBothWithoutIPv4(t *testing.T) {
+	container := newDualStackContainer(map[string]string{"com.github.njasm.clerk.address.family": FAMILY_BOTH})
+	container.Networks = map[string]Network{"bridge": {GlobalIPv6Address: "fd00::2"}}
+
+	srv := NewFrom(container)
+	assert.Equal(t, map[string]Instance{
+		"web:tcp:80:host:ipv6": {ID: "web:tcp:80:host:ipv6", Name: "web", IP: "fd00::2", Port: 80, Proto: "tcp"},
+	}, srv.Addressed().Instances())
+	assert.Equal(t, "web:tcp:80:host:ipv6", srv.ID())
+	assert.Len(t, srv.Errors(), 1)
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+}
+
+func TestAddressFamilyUnknown(t *testing.T) {
+	srv := NewFrom(newDualStackContainer(map[string]string{"com.github.njasm.clerk.address.family": "ipv5"}))
+
+	assert.Equal(t, "10.0.0.2", srv.IPAddress())
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+	assert.Len(t, srv.Diagnostics(), 1)
+}
+
+func TestAddressFamilyUnregisterAfterDie(t *testing.T) {
+	useAdvertiser(t, &Advertiser{address: "192.168.1.10"})
+
+	// the IPv6 instance of each family
+	scenarios := map[string]string{
+		FAMILY_IPV6: "web:tcp:80:host",
+		FAMILY_BOTH: "web:tcp:80:host:ipv6",
+	}
+
+	for family, ipv6ID := range scenarios {
+		t.Run(family, func(t *testing.T) {
+			container := newDualStackContainer(map[string]string{"com.github.njasm.clerk.address.family": family})
+			running := NewFrom(container)
+
+			// a dead container has no address anymore
+			container.Networks = map[string]Network{"backend": {}}
+			dead := NewFrom(container)
+
+			assert.Equal(t, running.ID(), dead.ID())
+			assert.ElementsMatch(t, keys(running.Instances()), keys(dead.Instances()))
+			assert.Contains(t, dead.Instances(), ipv6ID)
+			assert.NotContains(t, dead.Addressed().Instances(), ipv6ID)
+		})
+	}
+}
@@ -0,0 +1,386 @@
+package service
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+// The advertise address is the address of the host, used for containers without a
+// routable address of their own, like host network containers. It is the first found of
+// the explicit address, the addresses of the advertise interface, the addresses returned
+// by the metadata URL and the addresses of the default route interface.
+const (
+	envAdvertiseAddress   = "CLERK_ADVERTISE_ADDRESS"
+	envAdvertiseInterface = "CLERK_ADVERTISE_INTERFACE"
+	envAdvertiseURL       = "CLERK_ADVERTISE_URL"
+	envAdvertiseRefresh   = "CLERK_ADVERTISE_REFRESH"
+
+	defaultAdvertiseRefresh = "1m"
+	advertiseURLTimeout     = 2 * time.Second
+)
+
+// Sources of the advertise address.
+const (
+	ADVERTISE_EXPLICIT      = "explicit"
+	ADVERTISE_INTERFACE     = "interface"
+	ADVERTISE_METADATA      = "metadata"
+	ADVERTISE_DEFAULT_ROUTE = "default-route"
+)
+
+// Advertised is the resolved advertise address, one of each family at most.
+type Advertised struct {
+	IPv4   string
+	IPv6   string
+	Source string
+}
+
+// Address returns the IPv4 address, or the IPv6 one without IPv4 address.
+func (a Advertised) Address() string {
+	if a.IPv4 != "" {
+		return a.IPv4
+	}
+
+	return a.IPv6
+}
+
+// Advertiser resolves the advertise address and keeps the last resolved one.
+type Advertiser struct {
+	address string
+	iface   string
+	url     string
+	refresh time.Duration
+	procNet string
+	client  *http.Client
+
+	mu       sync.RWMutex
+	resolved bool
+	current  Advertised
+	// err is why the address couldn't be resolved yet, kept until the next refresh
+	err error
+}
+
+// NewAdvertiser reads the advertise configuration, CLERK_ADVERTISE_REFRESH is how often
+// the address is resolved again, 0 never does.
+func NewAdvertiser() (*Advertiser, error) {
+	refresh, err := time.ParseDuration(utils.EnvOrDefault(envAdvertiseRefresh, defaultAdvertiseRefresh))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %s: %v", ErrAddress, envAdvertiseRefresh, err)
+	}
+
+	return &Advertiser{
+		address: utils.EnvOrDefault(envAdvertiseAddress, ""),
+		iface:   utils.EnvOrDefault(envAdvertiseInterface, ""),
+		url:     utils.EnvOrDefault(envAdvertiseURL, ""),
+		refresh: refresh,
+		procNet: "/proc/net",
+		client:  &http.Client{Timeout: advertiseURLTimeout},
+	}, nil
+}
+
+// Resolve finds the advertise address, without keeping it.
+func (a *Advertiser) Resolve() (Advertised, error) {
+	switch {
+	case a.address != "":
+		return advertised(ADVERTISE_EXPLICIT, strings.Split(a.address, ","))
+	case a.iface != "":
+		return interfaceAddresses(a.iface, ADVERTISE_INTERFACE)
+	case a.url != "":
+		return a.metadata()
+	}
+
+	name, err := defaultRouteInterface(a.procNet)
+	if err != nil {
+		return Advertised{}, err
+	}
+
+	return interfaceAddresses(name, ADVERTISE_DEFAULT_ROUTE)
+}
+
+// Refresh resolves the advertise address again, and reports whether it changed.
+// The last address is kept when it can't be resolved.
+func (a *Advertiser) Refresh() (bool, error) {
+	rv, err := a.Resolve()
+
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if err != nil {
+		if !a.resolved {
+			a.err = err
+		}
+
+		return false, err
+	}
+
+	changed := a.resolved && rv != a.current
+	a.resolved, a.current, a.err = true, rv, nil
+
+	return changed, nil
+}
+
+// Addresses returns the last resolved advertise address, resolving it on first use.
+// A failure is returned as is until the next refresh resolves it again.
+func (a *Advertiser) Addresses() (Advertised, error) {
+	a.mu.RLock()
+	resolved, current, err := a.resolved, a.current, a.err
+	a.mu.RUnlock()
+
+	switch {
+	case resolved:
+		return current, nil
+	case err != nil:
+		return Advertised{}, err
+	}
+
+	if _, err := a.Refresh(); err != nil {
+		return Advertised{}, err
+	}
+
+	return a.Addresses()
+}
+
+// Watch resolves the advertise address every refresh interval until ctx is done, and
+// calls changed with the new address when it changes.
+func (a *Advertiser) Watch(ctx context.Context, changed func(Advertised)) {
+	if a.refresh <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(a.refresh)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			ok, err := a.Refresh()
+			if err != nil {
+				fmt.Println(fmt.Errorf("error: %w", err))
+				continue
+			}
+
+			if ok {
+				current, _ := a.Addresses()
+				changed(current)
+			}
+		}
+	}
+}
+
+// metadata reads the addresses returned by the metadata URL, separated by commas or spaces.
+func (a *Advertiser) metadata() (Advertised, error) {
+	response, err := a.client.Get(a.url)
+	if err != nil {
+		return Advertised{}, fmt.Errorf("%w: advertise url: %v", ErrAddress, err)
+	}
+
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return Advertised{}, fmt.Errorf("%w: advertise url: %s", ErrAddress, response.Status)
+	}
+
+	body, err := io.ReadAll(io.LimitReader(response.Body, 4096))
+	if err != nil {
+		return Advertised{}, fmt.Errorf("%w: advertise url: %v", ErrAddress, err)
+	}
+
+	fields := strings.FieldsFunc(string(body), func(r rune) bool {
+		return r == ',' || r == ' ' || r == '\n' || r == '\r' || r == '\t'
+	})
+
+	return advertised(ADVERTISE_METADATA, fields)
+}
+
+var (
+	advertiserMu sync.RWMutex
+	advertiser   *Advertiser
+)
+
+// SetAdvertiser makes a the advertiser of every service. Without one, every service
+// resolves the advertise address on its own.
+func SetAdvertiser(a *Advertiser) {
+	advertiserMu.Lock()
+	defer advertiserMu.Unlock()
+
+	advertiser = a
+}
+
+// Advertise returns the advertise address of the host.
+func Advertise() (Advertised, error) {
+	advertiserMu.RLock()
+	a := advertiser
+	advertiserMu.RUnlock()
+
+	if a != nil {
+		return a.Addresses()
+	}
+
+	a, err := NewAdvertiser()
+	if err != nil {
+		return Advertised{}, err
+	}
+
+	return a.Resolve()
+}
+
+// Advertised reports whether an instance of the service is registered with the advertise address.
+func (s *Service) Advertised() bool {
+	return s.advertised || s.container.Advertised
+}
+
+// advertiseAddresses returns the advertise address of the container label, or of the host.
+// The host one is resolved once per service, whether it succeeds or not.
+func (s *Service) advertiseAddresses() (Advertised, error) {
+	if text, ok := s.GetConfig(constants.CONFIG_ADVERTISE_ADDRESS); ok {
+		return advertised(ADVERTISE_EXPLICIT, strings.Split(text, ","))
+	}
+
+	if s.host == nil {
+		host, err := Advertise()
+		s.host, s.hostErr = &host, err
+	}
+
+	return *s.host, s.hostErr
+}
+
+// defaultRouteInterface returns the interface of the IPv4 default route, or of the IPv6
+// one, from the route and ipv6_route tables of procNet.
+func defaultRouteInterface(procNet string) (string, error) {
+	// Iface Destination Gateway ...
+	if name, err := routeInterface(filepath.Join(procNet, "route"), 1, 0, "00000000"); err == nil && name != "" {
+		return name, nil
+	}
+
+	// Destination PrefixLength Source ... Iface, the last field
+	if name, err := routeInterface(filepath.Join(procNet, "ipv6_route"), 0, -1, strings.Repeat("0", 32)); err == nil && name != "" {
+		return name, nil
+	}
+
+	return "", fmt.Errorf("%w: no default route, set %s or %s", ErrAddress, envAdvertiseAddress, envAdvertiseInterface)
+}
+
+// routeInterface returns the interface of the first route of the table to destination.
+// A negative iface field counts from the end of the line.
+func routeInterface(table string, destinationField, ifaceField int, destination string) (string, error) {
+	f, err := os.Open(table)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) <= destinationField || fields[destinationField] != destination {
+			continue
+		}
+
+		field := ifaceField
+		if field < 0 {
+			field += len(fields)
+		}
+
+		if field >= 0 && field < len(fields) && fields[field] != "lo" {
+			return fields[field], nil
+		}
+	}
+
+	return "", scanner.Err()
+}
+
+// interfaceAddresses returns the first IPv4 and the first global IPv6 address of the interface.
+func interfaceAddresses(name, source string) (Advertised, error) {
+	iface, err := net.InterfaceByName(name)
+	if err != nil {
+		return Advertised{}, fmt.Errorf("%w: advertise interface %s: %v", ErrAddress, name, err)
+	}
+
+	addrs, err := iface.Addrs()
+	if err != nil {
+		return Advertised{}, fmt.Errorf("%w: advertise interface %s: %v", ErrAddress, name, err)
+	}
+
+	ips := []string{}
+	for _, addr := range addrs {
+		if ipNet, ok := addr.(*net.IPNet); ok && ipNet.IP.IsGlobalUnicast() {
+			ips = append(ips, ipNet.IP.String())
+		}
+	}
+
+	if len(ips) == 0 {
+		return Advertised{}, fmt.Errorf("%w: advertise interface %s has no address", ErrAddress, name)
+	}
+
+	return advertised(source, ips)
+}
+
+// advertised returns the first IPv4 and the first IPv6 address of ips.
+func advertised(source string, ips []string) (Advertised, error) {
+	rv := Advertised{Source: source}
+	for _, text := range ips {
+		ip := net.ParseIP(strings.TrimSpace(text))
+		switch {
+		case ip == nil:
+			return Advertised{}, fmt.Errorf("%w: invalid advertise address %q", ErrAddress, text)
+		case ip.To4() != nil:
+			if rv.IPv4 == "" {
+				rv.IPv4 = ip.String()
+			}
+		case rv.IPv6 == "":
+			rv.IPv6 = ip.String()
+		}
+	}
+
+	if rv.Address() == "" {
+		return Advertised{}, fmt.Errorf("%w: no advertise address", ErrAddress)
+	}
+
+	return rv, nil
+}
+
+// defaultBridges are the subnets of the default bridge networks of Docker, Podman and
+// nerdctl, only reachable from the host they are on.
+var defaultBridges = []*net.IPNet{
+	mustParseCIDR("172.17.0.0/16"),
+	mustParseCIDR("10.88.0.0/16"),
+	mustParseCIDR("10.4.0.0/24"),
+}
+
+func mustParseCIDR(cidr string) *net.IPNet {
+	_, subnet, err := net.ParseCIDR(cidr)
+	if err != nil {
+		panic(err)
+	}
+
+	return subnet
+}
+
+// routable reports whether ip can be reached from other hosts. Loopback, link-local and
+// default bridge addresses can't, the addresses of any other network are assumed to be.
+func routable(ip string) bool {
+	parsed := net.ParseIP(ip)
+	if parsed == nil || parsed.IsUnspecified() || parsed.IsLoopback() || parsed.IsLinkLocalUnicast() {
+		return false
+	}
+
+	for _, subnet := range defaultBridges {
+		if subnet.Contains(parsed) {
+			return false
+		}
+	}
+
+	return true
+}
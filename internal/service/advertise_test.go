@@ -0,0 +1,306 @@
+package service
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// useAdvertiser makes a the advertiser of the test, without one the advertise address of
+// the host running the tests would be used.
+func useAdvertiser(t *testing.T, a *Advertiser) {
+	t.Helper()
+	if a.procNet == "" {
+		a.procNet = t.TempDir()
+	}
+
+	SetAdvertiser(a)
+	t.Cleanup(func() { SetAdvertiser(nil) })
+}
+
+func newHostNetworkContainer(labels map[string]string) Container {
+	return Container{
+		Name:        "web",
+		Hostname:    "host",
+		Labels:      labels,
+		Networks:    map[string]Network{"host": {}},
+		HostNetwork: true,
+	}
+}
+
+func TestHostNetwork(t *testing.T) {
+	useAdvertiser(t, &Advertiser{address: "192.168.1.10, 2001:db8::10"})
+
+	srv := NewFrom(newHostNetworkContainer(map[string]string{
+		"com.github.njasm.clerk.ports": "8080/tcp,9090/tcp",
+	}))
+
+	assert.Empty(t, srv.Errors())
+	assert.Equal(t, map[string]Instance{
+		"web:tcp:8080:host": {ID: "web:tcp:8080:host", Name: "web", IP: "192.168.1.10", Port: 8080, Proto: "tcp"},
+		"web:tcp:9090:host": {ID: "web:tcp:9090:host", Name: "web", IP: "192.168.1.10", Port: 9090, Proto: "tcp"},
+	}, srv.Instances())
+
+	// the label wins over the global address, and address families still apply
+	srv = NewFrom(newHostNetworkContainer(map[string]string{
+		"com.github.njasm.clerk.ports":             "8080",
+		"com.github.njasm.clerk.advertise.address": "2001:db8::20",
+		"com.github.njasm.clerk.address.family":    FAMILY_IPV6,
+	}))
+
+	assert.Equal(t, "2001:db8::20", srv.IPAddress())
+}
+
+func TestHostNetworkWithoutAdvertiseAddress(t *testing.T) {
+	useAdvertiser(t, &Advertiser{})
+
+	srv := NewFrom(newHostNetworkContainer(map[string]string{"com.github.njasm.clerk.ports": "8080"}))
+
+	assert.Empty(t, srv.Addressed().Instances())
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+}
+
+func TestHostNetworkWithoutPorts(t *testing.T) {
+	useAdvertiser(t, &Advertiser{address: "192.168.1.10"})
+
+	srv := NewFrom(newHostNetworkContainer(nil))
+
+	assert.Empty(t, srv.Instances())
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+}
+
+func TestHostNetworkIPv4Missing(t *testing.T) {
+	useAdvertiser(t, &Advertiser{address: "2001:db8::10"})
+
+	srv := NewFrom(newHostNetworkContainer(map[string]string{"com.github.njasm.clerk.ports": "8080"}))
+
+	assert.Empty(t, srv.Addressed().Instances())
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+}
+
+func TestAdvertiseInterface(t *testing.T) {
+	useAdvertiser(t, &Advertiser{iface: "clerk-missing0"})
+
+	srv := NewFrom(newHostNetworkContainer(map[string]string{"com.github.njasm.clerk.ports": "8080"}))
+
+	assert.Empty(t, srv.Addressed().Instances())
+	assert.ErrorIs(t, srv.Errors()[0], ErrAddress)
+}
+
+func TestAdvertised(t *testing.T) {
+	rv, err := advertised(ADVERTISE_EXPLICIT, []string{"2001:db8::1", " 10.0.0.1", "10.0.0.2"})
+	assert.NoError(t, err)
+	assert.Equal(t, Advertised{IPv4: "10.0.0.1", IPv6: "2001:db8::1", Source: ADVERTISE_EXPLICIT}, rv)
+	assert.Equal(t, "10.0.0.1", rv.Address())
+
+	_, err = advertised(ADVERTISE_EXPLICIT, []string{"not-an-ip"})
+	assert.ErrorIs(t, err, ErrAddress)
+}
+
+// newMetadataServer answers with the current address, followed by a new line.
+func newMetadataServer(address *atomic.Value) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte(address.Load().(string) + "\n"))
+	}))
+}
+
+func TestAdvertiseMetadataURL(t *testing.T) {
+	address := &atomic.Value{}
+	address.Store("10.1.2.3")
+	server := newMetadataServer(address)
+	defer server.Close()
+
+	a := &Advertiser{url: server.URL, client: server.Client()}
+	rv, err := a.Addresses()
+	assert.NoError(t, err)
+	assert.Equal(t, Advertised{IPv4: "10.1.2.3", Source: ADVERTISE_METADATA}, rv)
+
+	// the address is kept until refreshed
+	address.Store("10.1.2.4")
+	rv, _ = a.Addresses()
+	assert.Equal(t, "10.1.2.3", rv.IPv4)
+
+	changed, err := a.Refresh()
+	assert.NoError(t, err)
+	assert.True(t, changed)
+	rv, _ = a.Addresses()
+	assert.Equal(t, "10.1.2.4", rv.IPv4)
+}
+
+func TestAdvertiseWatch(t *testing.T) {
+	address := &atomic.Value{}
+	address.Store("10.1.2.3")
+	server := newMetadataServer(address)
+	defer server.Close()
+
+	a := &Advertiser{url: server.URL, client: server.Client(), refresh: 10 * time.Millisecond}
+	_, err := a.Addresses()
+	assert.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	changes := make(chan Advertised, 1)
+	go a.Watch(ctx, func(rv Advertised) { changes <- rv })
+
+	address.Store("10.1.2.4")
+	select {
+	case rv := <-changes:
+		assert.Equal(t, "10.1.2.4", rv.IPv4)
+	case <-time.After(time.Second):
+		t.Fatal("address change not reported")
+	}
+}
+
+func TestDefaultRouteInterface(t *testing.T) {
+	dir := t.TempDir()
+	_, err := defaultRouteInterface(dir)
+	assert.ErrorIs(t, err, ErrAddress)
+
+	route := "Iface\tDestination\tGateway\tFlags\n" +
+		"eth1\t0002000A\t00000000\t0001\n" +
+		"eth0\t00000000\t0102000A\t0003\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "route"), []byte(route), 0644))
+
+	name, err := defaultRouteInterface(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "eth0", name)
+
+	ipv6Route := "00000000000000000000000000000000 00 00000000000000000000000000000000 00 fe800000000000000000000000000001 00000400 00000001 00000000 00000003     eth2\n"
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "route"), []byte(""), 0644))
+	assert.Nil(t, os.WriteFile(filepath.Join(dir, "ipv6_route"), []byte(ipv6Route), 0644))
+
+	name, err = defaultRouteInterface(dir)
+	assert.NoError(t, err)
+	assert.Equal(t, "eth2", name)
+}
+
+func TestUnroutableContainerAddress(t *testing.T) {
+	useAdvertiser(t, &Advertiser{address: "192.168.1.10"})
+
+	srv := NewFrom(Container{
+		Name:         "web",
+		Hostname:     "host",
+		Labels:       map[string]string{"com.github.njasm.clerk.name": "web-{{.Host.Address}}"},
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"slirp": {IPAddress: "127.0.0.1"}},
+	})
+
+	assert.True(t, srv.Advertised())
+	assert.Equal(t, "192.168.1.10", srv.IPAddress())
+	assert.Equal(t, "web-192.168.1.10", srv.Name())
+
+	srv = NewFrom(Container{
+		Name:         "web",
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.False(t, srv.Advertised())
+	assert.Equal(t, "10.0.0.2", srv.IPAddress())
+}
+
+func TestDefaultBridgeContainerPublishedPorts(t *testing.T) {
+	useAdvertiser(t, &Advertiser{address: "192.168.1.10"})
+
+	srv := NewFrom(Container{
+		Name:           "web",
+		Hostname:       "host",
+		ExposedPorts:   []string{"443/tcp", "80/tcp"},
+		PublishedPorts: map[string]int{"80/tcp": 8080},
+		Networks:       map[string]Network{"bridge": {IPAddress: "172.17.0.2"}},
+	})
+
+	assert.True(t, srv.Advertised())
+	instances := map[string]Instance{}
+	for _, instance := range srv.Instances() {
+		instances[instance.ID] = instance
+	}
+
+	assert.Equal(t, "192.168.1.10", instances["web:tcp:80:host"].IP)
+	assert.Equal(t, 8080, instances["web:tcp:80:host"].Port)
+	assert.Equal(t, 443, instances["web:tcp:443:host"].Port)
+}
+
+func TestRoutable(t *testing.T) {
+	assert.True(t, routable("10.0.0.2"))
+	assert.True(t, routable("172.18.0.2"))
+	assert.True(t, routable("fd00::2"))
+	assert.False(t, routable(""))
+	assert.False(t, routable("127.0.0.1"))
+	assert.False(t, routable("fe80::1"))
+	assert.False(t, routable("172.17.0.2"))
+	assert.False(t, routable("10.88.0.5"))
+}
+
+// newFailingMetadataServer fails every request, and counts them.
+func newFailingMetadataServer(requests *int32) *httptest.Server {
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		atomic.AddInt32(requests, 1)
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+}
+
+func TestAdvertiseFailureKeptUntilRefresh(t *testing.T) {
+	var requests int32
+	server := newFailingMetadataServer(&requests)
+	defer server.Close()
+
+	a := &Advertiser{url: server.URL, client: server.Client()}
+	_, err := a.Addresses()
+	assert.ErrorIs(t, err, ErrAddress)
+	_, err = a.Addresses()
+	assert.ErrorIs(t, err, ErrAddress)
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+
+	_, err = a.Refresh()
+	assert.ErrorIs(t, err, ErrAddress)
+	assert.Equal(t, int32(2), atomic.LoadInt32(&requests))
+}
+
+func TestAdvertiseResolvedOnlyWhenUsed(t *testing.T) {
+	var requests int32
+	server := newFailingMetadataServer(&requests)
+	defer server.Close()
+
+	useAdvertiser(t, &Advertiser{url: server.URL, client: server.Client()})
+
+	srv := NewFrom(Container{
+		Name:         "web",
+		Labels:       map[string]string{"com.github.njasm.clerk.tags": "{{.Container.Name}},{{.Port}}"},
+		ExposedPorts: []string{"80/tcp", "443/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Equal(t, []string{"web", "80"}, srv.Tags())
+	assert.Equal(t, int32(0), atomic.LoadInt32(&requests))
+
+	// the failure is resolved once for the service
+	srv = NewFrom(Container{
+		Name:         "web",
+		Labels:       map[string]string{"com.github.njasm.clerk.id": "{{.Port}}@{{.Host.Address}}"},
+		ExposedPorts: []string{"80/tcp", "443/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Contains(t, srv.Instances(), "80@")
+	assert.Equal(t, int32(1), atomic.LoadInt32(&requests))
+}
+
+func TestRuntimeAdvertisedContainer(t *testing.T) {
+	srv := NewFrom(Container{
+		Name:         "web",
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"ingress": {IPAddress: "192.168.1.10"}},
+		Advertised:   true,
+	})
+
+	assert.True(t, srv.Advertised())
+}
@@ -0,0 +1,134 @@
+package service
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/njasm/clerk/internal/constants"
+)
+
+var ErrAttributes = errors.New("invalid attributes")
+
+// attributeLabelPrefix is the config key prefix of the attributes.<key> labels.
+const attributeLabelPrefix = constants.CONFIG_SERVICE_ATTRIBUTES + "."
+
+// setAttributes builds the attributes of the service. Precedence, highest first:
+// attributes.<key> labels, the attributes label or its global default, and the
+// registrator metadata.
+func (s *Service) setAttributes() *Service {
+	s.attributes = s.registratorAttributes()
+	data := s.templateData(s.primaryPort())
+	if text, ok := s.renderConfig(constants.CONFIG_SERVICE_ATTRIBUTES, envServiceAttributes, data); ok {
+		attributes, err := parseAttributes(text)
+		if err != nil {
+			s.errors = append(s.errors, err)
+		}
+
+		for key, value := range attributes {
+			s.attributes[key] = value
+		}
+	}
+
+	for key, text := range s.ConfigWithPrefix(attributeLabelPrefix) {
+		value, err := render(attributeLabelPrefix+key, text, data)
+		if err != nil {
+			s.errors = append(s.errors, err)
+			continue
+		}
+
+		s.attributes[key] = value
+	}
+
+	return s
+}
+
+// parseAttributes reads a JSON object, like {"owner":"team-a","port":8080}, or the compact
+// form, like owner:team-a,url:http://host:8080. In the compact form pairs are separated by
+// `,`, the key ends at the first `:` and `\` escapes a `,`, a `:` or itself. Every valid pair
+// is returned, along with an error for the invalid ones.
+func parseAttributes(text string) (map[string]string, error) {
+	if trimmed := strings.TrimSpace(text); strings.HasPrefix(trimmed, "{") {
+		return parseJSONAttributes(trimmed)
+	}
+
+	rv := map[string]string{}
+	invalid := []string{}
+	for _, pair := range splitEscaped(text, ',') {
+		fields := splitEscaped(pair, ':')
+		key := strings.TrimSpace(unescape(fields[0]))
+		if len(fields) < 2 || key == "" {
+			if strings.TrimSpace(pair) != "" {
+				invalid = append(invalid, pair)
+			}
+
+			continue
+		}
+
+		// the key ends at the first `:`, the value keeps the others
+		value := strings.TrimPrefix(pair, fields[0]+":")
+		rv[key] = strings.TrimSpace(unescape(value))
+	}
+
+	if len(invalid) > 0 {
+		return rv, fmt.Errorf("%w: pairs without key or value: %q", ErrAttributes, invalid)
+	}
+
+	return rv, nil
+}
+
+// parseJSONAttributes reads a JSON object, values that aren't strings are kept as JSON.
+func parseJSONAttributes(text string) (map[string]string, error) {
+	object := map[string]json.RawMessage{}
+	if err := json.Unmarshal([]byte(text), &object); err != nil {
+		return map[string]string{}, fmt.Errorf("%w: %v", ErrAttributes, err)
+	}
+
+	rv := map[string]string{}
+	for key, raw := range object {
+		var value string
+		if err := json.Unmarshal(raw, &value); err != nil {
+			value = string(raw)
+		}
+
+		rv[key] = value
+	}
+
+	return rv, nil
+}
+
+// splitEscaped splits text around the separators not preceded by a `\`, escapes are kept.
+func splitEscaped(text string, sep byte) []string {
+	rv := []string{}
+	start := 0
+	for i := 0; i < len(text); i++ {
+		switch text[i] {
+		case '\\':
+			i++
+		case sep:
+			rv = append(rv, text[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(rv, text[start:])
+}
+
+// unescape removes the `\` escaping the next character.
+func unescape(text string) string {
+	if !strings.Contains(text, `\`) {
+		return text
+	}
+
+	var b strings.Builder
+	for i := 0; i < len(text); i++ {
+		if text[i] == '\\' && i+1 < len(text) {
+			i++
+		}
+
+		b.WriteByte(text[i])
+	}
+
+	return b.String()
+}
@@ -0,0 +1,67 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseAttributes(t *testing.T) {
+	scenarios := map[string]map[string]string{
+		"owner:team-a,tier:gold":                   {"owner": "team-a", "tier": "gold"},
+		"url:http://api:8080/v1, opens:08:30":      {"url": "http://api:8080/v1", "opens": "08:30"},
+		`list:a\,b\,c,key\:with\:colons:value`:     {"list": "a,b,c", "key:with:colons": "value"},
+		`path:C\\Temp`:                             {"path": `C\Temp`},
+		`{"owner":"team-a","port":8080,"on":true}`: {"owner": "team-a", "port": "8080", "on": "true"},
+		"": {},
+	}
+
+	for text, expected := range scenarios {
+		t.Run(text, func(t *testing.T) {
+			attributes, err := parseAttributes(text)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, attributes)
+		})
+	}
+}
+
+func TestParseAttributesErrors(t *testing.T) {
+	attributes, err := parseAttributes("owner:team-a,orphan,:value")
+	assert.ErrorIs(t, err, ErrAttributes)
+	assert.Equal(t, map[string]string{"owner": "team-a"}, attributes)
+
+	_, err = parseAttributes(`{"owner":`)
+	assert.ErrorIs(t, err, ErrAttributes)
+}
+
+func TestAttributeLabels(t *testing.T) {
+	srv := NewFrom(Container{
+		Name:     "web",
+		Hostname: "host",
+		Labels: map[string]string{
+			"com.github.njasm.clerk.attributes":       `{"owner":"team-a","tier":"silver"}`,
+			"com.github.njasm.clerk.attributes.tier":  "gold",
+			"com.github.njasm.clerk.attributes.image": "{{.Container.Image}}",
+		},
+		Image:        "nginx:1.25",
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Equal(t, map[string]string{"owner": "team-a", "tier": "gold", "image": "nginx:1.25"}, srv.Attributes())
+	assert.Empty(t, srv.Errors())
+	assert.Empty(t, srv.Diagnostics())
+}
+
+func TestInvalidAttributes(t *testing.T) {
+	srv := NewFrom(Container{
+		Name:         "web",
+		Labels:       map[string]string{"com.github.njasm.clerk.attributes": "owner:team-a,orphan"},
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Equal(t, map[string]string{"owner": "team-a"}, srv.Attributes())
+	assert.Len(t, srv.Errors(), 1)
+	assert.Len(t, srv.Diagnostics(), 1)
+}
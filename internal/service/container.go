@@ -0,0 +1,28 @@
+package service
+
+// Container is the runtime neutral description of a container a Service is built from.
+// Every container runtime converts its own inspect result into one.
+type Container struct {
+	ID       string
+	Name     string
+	Hostname string
+	Image    string
+	Labels   map[string]string
+	Env      []string
+	// ExposedPorts are port/proto pairs, like 80/tcp
+	ExposedPorts []string
+	// PublishedPorts are the host ports of the exposed ports published on the host, like
+	// 80/tcp: 8080
+	PublishedPorts map[string]int
+	// Networks are keyed by network name
+	Networks map[string]Network
+	// HostNetwork containers share the network of the host and have no address of their own
+	HostNetwork bool
+	// Advertised containers are published by their runtime on the advertise address of the host
+	Advertised bool
+}
+
+type Network struct {
+	IPAddress         string
+	GlobalIPv6Address string
+}
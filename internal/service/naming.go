@@ -0,0 +1,82 @@
+package service
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const (
+	envNamingStrategy = "CLERK_NAMING_STRATEGY"
+	envNodeName       = "CLERK_NODE_NAME"
+)
+
+// Naming strategies for services without an explicit name label. With the compose
+// strategies every replica of a Compose service is an instance of the same service,
+// identified by the node it runs on, its project, service and replica number.
+const (
+	NAMING_CONTAINER       = "container"
+	NAMING_COMPOSE         = "compose"
+	NAMING_COMPOSE_PROJECT = "compose-project"
+)
+
+// namingStrategy returns the strategy of the container label, or the global one.
+func (s *Service) namingStrategy() string {
+	if strategy, ok := s.GetConfig(constants.CONFIG_NAMING_STRATEGY); ok {
+		return trimAndLowerString(strategy)
+	}
+
+	return trimAndLowerString(utils.EnvOrDefault(envNamingStrategy, NAMING_CONTAINER))
+}
+
+// composeName returns the name of the Compose service of the container, and its replica number.
+func (s *Service) composeName(withProject bool) (string, string, bool) {
+	name := s.container.Labels[constants.COMPOSE_SERVICE]
+	if name == "" {
+		return "", "", false
+	}
+
+	if project := s.container.Labels[constants.COMPOSE_PROJECT]; withProject && project != "" {
+		name = project + "-" + name
+	}
+
+	return name, s.container.Labels[constants.COMPOSE_CONTAINER_NUMBER], true
+}
+
+// NodeName returns the identity of the host clerk runs on, CLERK_NODE_NAME or else its
+// advertise address. Unlike the hostname, which is the container ID when clerk runs in a
+// container, it survives clerk restarts.
+func NodeName() (string, error) {
+	if name := strings.TrimSpace(utils.EnvOrDefault(envNodeName, "")); name != "" {
+		return name, nil
+	}
+
+	advertised, err := Advertise()
+	if err != nil {
+		return "", fmt.Errorf("%w, set %s", err, envNodeName)
+	}
+
+	return advertised.Address(), nil
+}
+
+// replicaHost identifies a Compose replica among the replicas of every host and project,
+// like node1:shop-web-1.
+func (s *Service) replicaHost() string {
+	parts := []string{}
+	for _, part := range []string{s.container.Labels[constants.COMPOSE_PROJECT], s.container.Labels[constants.COMPOSE_SERVICE], s.replica} {
+		if part != "" {
+			parts = append(parts, part)
+		}
+	}
+
+	replica := strings.Join(parts, "-")
+	node, err := NodeName()
+	if err != nil {
+		s.errors = append(s.errors, err)
+		return replica
+	}
+
+	return node + ":" + replica
+}
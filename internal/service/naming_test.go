@@ -0,0 +1,100 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newComposeContainer(replica string, labels map[string]string) Container {
+	c := Container{
+		ID:       "c" + replica,
+		Name:     "shop-web-" + replica,
+		Hostname: "c" + replica,
+		Labels: map[string]string{
+			"com.docker.compose.project":          "shop",
+			"com.docker.compose.service":          "web",
+			"com.docker.compose.container-number": replica,
+			"com.github.njasm.clerk.register":     "true",
+		},
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"shop_default": {IPAddress: "172.18.0." + replica}},
+	}
+
+	for key, value := range labels {
+		c.Labels[key] = value
+	}
+
+	return c
+}
+
+func TestNamingContainerIsDefault(t *testing.T) {
+	srv := NewFrom(newComposeContainer("1", nil))
+
+	assert.Equal(t, "shop-web-1", srv.Name())
+	assert.Equal(t, "shop-web-1:tcp:80:c1", srv.ID())
+}
+
+func TestNamingCompose(t *testing.T) {
+	t.Setenv(envNodeName, "node1")
+	t.Setenv(envNamingStrategy, NAMING_COMPOSE)
+
+	first := NewFrom(newComposeContainer("1", nil))
+	second := NewFrom(newComposeContainer("2", nil))
+
+	assert.Equal(t, "web", first.Name())
+	assert.Equal(t, "web", second.Name())
+	assert.Equal(t, "web:tcp:80:node1:shop-web-1", first.ID())
+	assert.Equal(t, "web:tcp:80:node1:shop-web-2", second.ID())
+}
+
+func TestNamingComposeProjectFromLabel(t *testing.T) {
+	t.Setenv(envNodeName, "node1")
+	srv := NewFrom(newComposeContainer("3", map[string]string{"com.github.njasm.clerk.naming": "compose-project"}))
+
+	assert.Equal(t, "shop-web", srv.Name())
+	assert.Equal(t, "shop-web:tcp:80:node1:shop-web-3", srv.ID())
+}
+
+func TestNamingComposeKeepsExplicitName(t *testing.T) {
+	t.Setenv(envNodeName, "node1")
+	t.Setenv(envNamingStrategy, NAMING_COMPOSE)
+
+	srv := NewFrom(newComposeContainer("2", map[string]string{"com.github.njasm.clerk.name": "storefront"}))
+
+	assert.Equal(t, "storefront", srv.Name())
+	assert.Equal(t, "storefront:tcp:80:node1:shop-web-2", srv.ID())
+}
+
+func TestNamingComposeWithoutComposeLabels(t *testing.T) {
+	t.Setenv(envNamingStrategy, NAMING_COMPOSE)
+
+	srv := NewFrom(Container{
+		Name:         "standalone",
+		Hostname:     "host",
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Equal(t, "standalone", srv.Name())
+	assert.Equal(t, "standalone:tcp:80:host", srv.ID())
+}
+
+func TestNamingComposeReplicaOfEveryProject(t *testing.T) {
+	t.Setenv(envNamingStrategy, NAMING_COMPOSE)
+	t.Setenv(envNodeName, "node1")
+
+	shop := NewFrom(newComposeContainer("1", nil))
+	blog := NewFrom(newComposeContainer("1", map[string]string{"com.docker.compose.project": "blog"}))
+
+	assert.Equal(t, "web:tcp:80:node1:shop-web-1", shop.ID())
+	assert.Equal(t, "web:tcp:80:node1:blog-web-1", blog.ID())
+}
+
+func TestNamingComposeNodeFromAdvertiseAddress(t *testing.T) {
+	t.Setenv(envNamingStrategy, NAMING_COMPOSE)
+	useAdvertiser(t, &Advertiser{address: "192.168.1.10"})
+
+	srv := NewFrom(newComposeContainer("1", nil))
+	assert.Equal(t, "web:tcp:80:192.168.1.10:shop-web-1", srv.ID())
+}
@@ -0,0 +1,210 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const (
+	envRegisterMode    = "CLERK_REGISTER_MODE"
+	envRegisterInclude = "CLERK_REGISTER_INCLUDE"
+	envRegisterExclude = "CLERK_REGISTER_EXCLUDE"
+	envLabelStrict     = "CLERK_LABEL_STRICT"
+)
+
+// Registration modes. With REGISTER_LABEL only containers labelled register=true, or
+// matching an include rule, are registered. With REGISTER_ALL every container with a
+// port is, unless it's labelled register=false.
+const (
+	REGISTER_LABEL = "label"
+	REGISTER_ALL   = "all"
+)
+
+var ErrInvalidRule = errors.New("invalid registration rule")
+
+// Policy decides which containers are registered, for every container of the host.
+// Exclude rules win over everything, including a register=true label.
+// In strict mode containers with invalid labels aren't registered either.
+type Policy struct {
+	mode    string
+	strict  bool
+	include []rule
+	exclude []rule
+}
+
+// rule matches a container when all its conditions do.
+type rule []condition
+
+type condition func(s *Service) bool
+
+// NewPolicy reads the registration mode and the include and exclude rules. Rules are
+// separated by `;`, and the conditions of a rule by `,`:
+//
+//	image=<glob>        image, * and ? wildcards
+//	name=<regexp>       container name
+//	network=<name>      attached to the network
+//	label=<selector>    key, !key, key=value or key!=value
+func NewPolicy() (*Policy, error) {
+	mode := trimAndLowerString(utils.EnvOrDefault(envRegisterMode, REGISTER_LABEL))
+	if mode != REGISTER_LABEL && mode != REGISTER_ALL {
+		return nil, fmt.Errorf("%w: %s must be %s or %s", ErrInvalidRule, envRegisterMode, REGISTER_LABEL, REGISTER_ALL)
+	}
+
+	include, err := parseRules(utils.EnvOrDefault(envRegisterInclude, ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", envRegisterInclude, err)
+	}
+
+	exclude, err := parseRules(utils.EnvOrDefault(envRegisterExclude, ""))
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", envRegisterExclude, err)
+	}
+
+	return &Policy{mode: mode, strict: utils.EnvBool(envLabelStrict), include: include, exclude: exclude}, nil
+}
+
+// Register reports whether the service should be registered.
+func (p *Policy) Register(s *Service) bool {
+	// no network address nor port defined
+	if len(s.Addressed().instances) == 0 {
+		return false
+	}
+
+	if matchAny(p.exclude, s) {
+		return false
+	}
+
+	if p.strict {
+		for _, diagnostic := range s.diagnostics {
+			if diagnostic.Severity == SEVERITY_ERROR {
+				return false
+			}
+		}
+	}
+
+	if label, ok := s.GetConfig(constants.CONFIG_CLERK_REGISTER); ok {
+		return trimAndLowerString(label) == "true"
+	}
+
+	if len(p.include) > 0 {
+		return matchAny(p.include, s)
+	}
+
+	return p.mode == REGISTER_ALL
+}
+
+func matchAny(rules []rule, s *Service) bool {
+	for _, r := range rules {
+		if r.match(s) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r rule) match(s *Service) bool {
+	for _, c := range r {
+		if !c(s) {
+			return false
+		}
+	}
+
+	return true
+}
+
+func parseRules(text string) ([]rule, error) {
+	rv := []rule{}
+	for _, ruleText := range strings.Split(text, ";") {
+		if strings.TrimSpace(ruleText) == "" {
+			continue
+		}
+
+		r := rule{}
+		for _, conditionText := range strings.Split(ruleText, ",") {
+			c, err := parseCondition(strings.TrimSpace(conditionText))
+			if err != nil {
+				return nil, err
+			}
+
+			r = append(r, c)
+		}
+
+		rv = append(rv, r)
+	}
+
+	return rv, nil
+}
+
+func parseCondition(text string) (condition, error) {
+	kind, value, ok := strings.Cut(text, "=")
+	if !ok || value == "" {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidRule, text)
+	}
+
+	switch strings.TrimSpace(kind) {
+	case "image":
+		pattern, err := glob(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidRule, text, err)
+		}
+
+		return func(s *Service) bool { return pattern.MatchString(s.container.Image) }, nil
+	case "name":
+		pattern, err := regexp.Compile(value)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %q: %v", ErrInvalidRule, text, err)
+		}
+
+		return func(s *Service) bool { return pattern.MatchString(strings.TrimLeft(s.container.Name, "/")) }, nil
+	case "network":
+		return func(s *Service) bool {
+			_, ok := s.container.Networks[value]
+			return ok
+		}, nil
+	case "label":
+		return labelSelector(value), nil
+	}
+
+	return nil, fmt.Errorf("%w: %q: unknown condition %s", ErrInvalidRule, text, kind)
+}
+
+// labelSelector matches key, !key, key=value or key!=value against the container labels.
+func labelSelector(selector string) condition {
+	if key, value, ok := strings.Cut(selector, "!="); ok {
+		return func(s *Service) bool { return s.container.Labels[key] != value }
+	}
+
+	if key, value, ok := strings.Cut(selector, "="); ok {
+		return func(s *Service) bool {
+			label, exists := s.container.Labels[key]
+			return exists && label == value
+		}
+	}
+
+	if key := strings.TrimPrefix(selector, "!"); key != selector {
+		return func(s *Service) bool {
+			_, exists := s.container.Labels[key]
+			return !exists
+		}
+	}
+
+	return func(s *Service) bool {
+		_, exists := s.container.Labels[selector]
+		return exists
+	}
+}
+
+// glob compiles a pattern where * matches any sequence, / included, and ? any character.
+func glob(pattern string) (*regexp.Regexp, error) {
+	quoted := regexp.QuoteMeta(pattern)
+	quoted = strings.ReplaceAll(quoted, `\*`, `.*`)
+	quoted = strings.ReplaceAll(quoted, `\?`, `.`)
+
+	return regexp.Compile("^" + quoted + "$")
+}
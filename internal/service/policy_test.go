@@ -0,0 +1,98 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPolicyContainer(name, image string, labels map[string]string) *Service {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return NewFrom(Container{
+		ID:           "abc123",
+		Name:         name,
+		Hostname:     "host",
+		Image:        image,
+		Labels:       labels,
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"frontend": {IPAddress: "10.0.0.2"}},
+	})
+}
+
+// registered reports whether the default policy registers srv.
+func registered(t *testing.T, srv *Service) bool {
+	t.Helper()
+	p, err := NewPolicy()
+	assert.NoError(t, err)
+
+	return p.Register(srv)
+}
+
+func TestPolicyLabelMode(t *testing.T) {
+	p, err := NewPolicy()
+	assert.Nil(t, err)
+
+	assert.False(t, p.Register(newPolicyContainer("web", "nginx:1.25", nil)))
+	assert.True(t, p.Register(newPolicyContainer("web", "nginx:1.25", map[string]string{"com.github.njasm.clerk.register": "true"})))
+}
+
+func TestPolicyWithoutInstances(t *testing.T) {
+	srv := NewFrom(Container{
+		Name:   "web",
+		Labels: map[string]string{"com.github.njasm.clerk.register": "true"},
+	})
+
+	assert.False(t, registered(t, srv))
+}
+
+func TestPolicyAllMode(t *testing.T) {
+	t.Setenv(envRegisterMode, "all")
+	p, err := NewPolicy()
+	assert.Nil(t, err)
+
+	assert.True(t, p.Register(newPolicyContainer("web", "nginx:1.25", nil)))
+	assert.False(t, p.Register(newPolicyContainer("web", "nginx:1.25", map[string]string{"com.github.njasm.clerk.register": "false"})))
+
+	// no port, nothing to register
+	assert.False(t, p.Register(NewFrom(Container{Name: "batch", Networks: map[string]Network{"frontend": {}}})))
+}
+
+func TestPolicyExcludeWins(t *testing.T) {
+	t.Setenv(envRegisterMode, "all")
+	t.Setenv(envRegisterExclude, "image=*/postgres:*;name=^tmp-;label=team!=payments,network=frontend")
+	p, err := NewPolicy()
+	assert.Nil(t, err)
+
+	registered := map[string]string{"com.github.njasm.clerk.register": "true", "team": "payments"}
+	assert.False(t, p.Register(newPolicyContainer("db", "docker.io/library/postgres:15", registered)))
+	assert.False(t, p.Register(newPolicyContainer("tmp-web", "nginx:1.25", registered)))
+	assert.False(t, p.Register(newPolicyContainer("web", "nginx:1.25", map[string]string{"team": "search"})))
+	assert.True(t, p.Register(newPolicyContainer("web", "nginx:1.25", map[string]string{"team": "payments"})))
+}
+
+func TestPolicyInclude(t *testing.T) {
+	t.Setenv(envRegisterInclude, "label=team=payments;image=nginx:*,label=!internal")
+	p, err := NewPolicy()
+	assert.Nil(t, err)
+
+	assert.True(t, p.Register(newPolicyContainer("api", "golang:1.20", map[string]string{"team": "payments"})))
+	assert.True(t, p.Register(newPolicyContainer("web", "nginx:1.25", nil)))
+	assert.False(t, p.Register(newPolicyContainer("web", "nginx:1.25", map[string]string{"internal": ""})))
+	assert.False(t, p.Register(newPolicyContainer("api", "golang:1.20", nil)))
+}
+
+func TestPolicyInvalidRules(t *testing.T) {
+	for _, rules := range []string{"image", "name=(", "color=blue", "label="} {
+		t.Setenv(envRegisterExclude, rules)
+		_, err := NewPolicy()
+		assert.ErrorIs(t, err, ErrInvalidRule, rules)
+	}
+
+	t.Setenv(envRegisterExclude, "")
+	t.Setenv(envRegisterMode, "sometimes")
+	_, err := NewPolicy()
+	assert.ErrorIs(t, err, ErrInvalidRule)
+}
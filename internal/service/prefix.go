@@ -0,0 +1,57 @@
+package service
+
+import (
+	"strings"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const (
+	envLabelPrefix    = "CLERK_LABEL_PREFIX"
+	envLabelNamespace = "CLERK_LABEL_NAMESPACE"
+)
+
+// LabelPrefix returns the prefix of the labels this clerk reads, CLERK_LABEL_PREFIX
+// followed by CLERK_LABEL_NAMESPACE when set, so clerk instances sharing a host only
+// consider the labels of their own namespace. Labels are kept in the config under
+// constants.CONFIG_PREFIX whatever their prefix.
+func LabelPrefix() string {
+	prefix := strings.ToLower(utils.EnvOrDefault(envLabelPrefix, constants.CONFIG_PREFIX))
+	if namespace := strings.ToLower(utils.EnvOrDefault(envLabelNamespace, "")); namespace != "" {
+		prefix = strings.TrimSuffix(prefix, ".") + "." + strings.Trim(namespace, ".")
+	}
+
+	return strings.TrimSuffix(prefix, ".") + "."
+}
+
+// configKey returns the config key of a label key with the label prefix, and false
+// when the label isn't under the prefix. Without namespace, the labels of the clerk
+// instances with one, like <prefix>payments.name, aren't under the prefix either.
+func configKey(labelKey, prefix string) (string, bool) {
+	if !strings.HasPrefix(labelKey, prefix) {
+		return "", false
+	}
+
+	key := strings.TrimPrefix(labelKey, prefix)
+	if utils.EnvOrDefault(envLabelNamespace, "") == "" && namespaced(key) {
+		return "", false
+	}
+
+	return constants.CONFIG_PREFIX + key, true
+}
+
+// namespaced reports whether key is a known label behind a namespace, one more segment.
+func namespaced(key string) bool {
+	if _, ok := lookupSpec(key); ok {
+		return false
+	}
+
+	_, rest, ok := strings.Cut(key, ".")
+	if !ok {
+		return false
+	}
+
+	_, ok = lookupSpec(rest)
+	return ok
+}
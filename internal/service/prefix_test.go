@@ -0,0 +1,92 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newPrefixContainer() Container {
+	return Container{
+		Name:     "web",
+		Hostname: "host",
+		Labels: map[string]string{
+			"com.github.njasm.clerk.register":      "true",
+			"com.github.njasm.clerk.name":          "default-ns",
+			"com.acme.discovery.register":          "true",
+			"com.acme.discovery.name":              "acme",
+			"com.acme.discovery.payments.register": "true",
+			"com.acme.discovery.payments.name":     "payments",
+			"com.acme.discovery.payments.tags":     "billing",
+		},
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	}
+}
+
+func TestLabelPrefix(t *testing.T) {
+	assert.Equal(t, "com.github.njasm.clerk.", LabelPrefix())
+
+	t.Setenv(envLabelPrefix, "com.acme.discovery")
+	assert.Equal(t, "com.acme.discovery.", LabelPrefix())
+
+	t.Setenv(envLabelNamespace, "Payments")
+	assert.Equal(t, "com.acme.discovery.payments.", LabelPrefix())
+}
+
+func TestLabelPrefixDefault(t *testing.T) {
+	srv := NewFrom(newPrefixContainer())
+
+	assert.Equal(t, "default-ns", srv.Name())
+}
+
+func TestLabelPrefixCustom(t *testing.T) {
+	t.Setenv(envLabelPrefix, "com.acme.discovery.")
+	srv := NewFrom(newPrefixContainer())
+
+	assert.Equal(t, "acme", srv.Name())
+	assert.True(t, registered(t, srv))
+	assert.Empty(t, srv.Tags())
+	assert.Empty(t, srv.Diagnostics())
+
+	name, ok := srv.GetConfig("com.acme.discovery.name")
+	assert.True(t, ok)
+	assert.Equal(t, "acme", name)
+}
+
+func TestLabelPrefixNamespace(t *testing.T) {
+	t.Setenv(envLabelPrefix, "com.acme.discovery.")
+	t.Setenv(envLabelNamespace, "payments")
+	srv := NewFrom(newPrefixContainer())
+
+	assert.Equal(t, "payments", srv.Name())
+	assert.Equal(t, []string{"billing"}, srv.Tags())
+	assert.Equal(t, map[string]string{
+		"com.github.njasm.clerk.register": "true",
+		"com.github.njasm.clerk.name":     "payments",
+		"com.github.njasm.clerk.tags":     "billing",
+	}, srv.Config())
+}
+
+func TestLabelPrefixIgnoresNamespaces(t *testing.T) {
+	srv := NewFrom(Container{
+		Name: "web",
+		Labels: map[string]string{
+			"com.github.njasm.clerk.register":              "true",
+			"com.github.njasm.clerk.kv.db.host":            "db.local",
+			"com.github.njasm.clerk.attributes.team":       "core",
+			"com.github.njasm.clerk.teamb.name":            "teamb-web",
+			"com.github.njasm.clerk.teamb.attributes.team": "b",
+		},
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Equal(t, "web", srv.Name())
+	assert.Equal(t, map[string]string{
+		"com.github.njasm.clerk.register":        "true",
+		"com.github.njasm.clerk.kv.db.host":      "db.local",
+		"com.github.njasm.clerk.attributes.team": "core",
+	}, srv.Config())
+	assert.Empty(t, srv.Diagnostics())
+}
@@ -0,0 +1,148 @@
+package service
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/docker/go-connections/nat"
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+const envProtocolNaming = "CLERK_PROTOCOL_NAMING"
+
+// Transport protocols of the instances.
+const (
+	PROTO_TCP  = "tcp"
+	PROTO_UDP  = "udp"
+	PROTO_SCTP = "sctp"
+)
+
+// Protocol namings, how instances of the same service on different protocols are told
+// apart. With PROTOCOL_TAG the protocol is a tag of every instance, the way Consul answers
+// RFC 2782 _name._udp SRV queries. With PROTOCOL_NAME the name of UDP and SCTP instances
+// ends with their protocol, like dns-udp.
+const (
+	PROTOCOL_NONE = "none"
+	PROTOCOL_TAG  = "tag"
+	PROTOCOL_NAME = "name"
+)
+
+var ErrProtocol = errors.New("protocol error")
+
+// TCP reports whether the instance accepts connections of TCP based checks, like HTTP or gRPC.
+func (i Instance) TCP() bool {
+	return i.Proto == "" || i.Proto == PROTO_TCP
+}
+
+// UDP reports whether the instance accepts UDP checks.
+func (i Instance) UDP() bool {
+	return i.Proto == PROTO_UDP
+}
+
+// CheckPort returns the port TCP based checks of every instance are run against, the
+// first TCP port of the service, or 0 without TCP instance.
+func (s *Service) CheckPort() int {
+	for _, rawPort := range s.ports() {
+		proto, port := nat.SplitProtoPort(rawPort)
+		intPort, err := strconv.Atoi(port)
+		if err != nil {
+			continue
+		}
+
+		for _, instance := range s.instances {
+			if instance.Port == intPort && instance.Proto == strings.ToLower(proto) && instance.TCP() {
+				return intPort
+			}
+		}
+	}
+
+	return 0
+}
+
+// diagnoseChecks reports the checks skipped on the instances of a protocol they can't
+// reach: TCP based checks on UDP and SCTP instances, UDP checks on the others.
+func (s *Service) diagnoseChecks() {
+	for _, key := range []string{"consul.check.http", "consul.check.https", "consul.check.tcp", "consul.check.grpc", "consul.check.udp"} {
+		if _, ok := s.GetConfig(key); !ok {
+			continue
+		}
+
+		supported := Instance.TCP
+		if key == "consul.check.udp" {
+			supported = Instance.UDP
+		}
+
+		skipped := map[string]bool{}
+		for _, instance := range s.instances {
+			if !supported(instance) {
+				skipped[instance.Proto] = true
+			}
+		}
+
+		protos := []string{}
+		for proto := range skipped {
+			protos = append(protos, proto)
+		}
+
+		if len(protos) > 0 {
+			sort.Strings(protos)
+			s.diagnose(key, SEVERITY_WARNING, "check skipped on %s ports, not supported", strings.Join(protos, " and "))
+		}
+	}
+}
+
+// protocolNaming returns the protocol naming of the container label, or the global one.
+func (s *Service) protocolNaming() string {
+	naming, ok := s.GetConfig(constants.CONFIG_PROTOCOL_NAMING)
+	if !ok {
+		naming = utils.EnvOrDefault(envProtocolNaming, PROTOCOL_NONE)
+	}
+
+	switch naming = trimAndLowerString(naming); naming {
+	case PROTOCOL_NONE, PROTOCOL_TAG, PROTOCOL_NAME:
+		return naming
+	}
+
+	s.errors = append(s.errors, fmt.Errorf("%w: unknown protocol naming %q, using %s", ErrProtocol, naming, PROTOCOL_NONE))
+	return PROTOCOL_NONE
+}
+
+// protocol returns the protocol of a port, lower cased, or an error for unknown ones.
+func protocol(proto string) (string, error) {
+	switch proto = strings.ToLower(strings.TrimSpace(proto)); proto {
+	case "", PROTO_TCP:
+		return PROTO_TCP, nil
+	case PROTO_UDP, PROTO_SCTP:
+		return proto, nil
+	}
+
+	return "", fmt.Errorf("%w: unknown protocol %q", ErrProtocol, proto)
+}
+
+// protocolName returns the name of an instance of name on proto.
+func (s *Service) protocolName(name, proto string) string {
+	if s.protoNaming != PROTOCOL_NAME || proto == PROTO_TCP {
+		return name
+	}
+
+	return name + "-" + proto
+}
+
+// InstanceTags returns the tags of instance, the service tags, or its registrator port
+// tags, and its protocol when tagged by protocol.
+func (s *Service) InstanceTags(instance Instance) []string {
+	tags := s.tags
+	if portTags, ok := s.registratorPortTags(instance.Port); ok {
+		tags = portTags
+	}
+
+	if s.protoNaming != PROTOCOL_TAG || utils.Any(tags, instance.Proto) {
+		return tags
+	}
+
+	return append(append([]string{}, tags...), instance.Proto)
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newProtocolContainer(labels map[string]string) Container {
+	return Container{
+		Name:         "dns",
+		Hostname:     "host",
+		Labels:       labels,
+		ExposedPorts: []string{"53/tcp", "53/UDP"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	}
+}
+
+func TestProtocolNamingNone(t *testing.T) {
+	srv := NewFrom(newProtocolContainer(map[string]string{"com.github.njasm.clerk.tags": "dns"}))
+
+	assert.Equal(t, map[string]Instance{
+		"dns:tcp:53:host": {ID: "dns:tcp:53:host", Name: "dns", IP: "10.0.0.2", Port: 53, Proto: "tcp"},
+		"dns:udp:53:host": {ID: "dns:udp:53:host", Name: "dns", IP: "10.0.0.2", Port: 53, Proto: "udp"},
+	}, srv.Instances())
+	assert.Equal(t, []string{"dns"}, srv.InstanceTags(srv.Instances()["dns:udp:53:host"]))
+}
+
+func TestProtocolNamingTag(t *testing.T) {
+	t.Setenv(envProtocolNaming, PROTOCOL_TAG)
+
+	srv := NewFrom(newProtocolContainer(map[string]string{"com.github.njasm.clerk.tags": "dns,udp"}))
+
+	assert.Equal(t, []string{"dns", "udp", "tcp"}, srv.InstanceTags(srv.Instances()["dns:tcp:53:host"]))
+	assert.Equal(t, []string{"dns", "udp"}, srv.InstanceTags(srv.Instances()["dns:udp:53:host"]))
+	assert.Equal(t, []string{"dns", "udp"}, srv.Tags())
+}
+
+func TestProtocolNamingName(t *testing.T) {
+	srv := NewFrom(newProtocolContainer(map[string]string{"com.github.njasm.clerk.proto.naming": "name"}))
+
+	assert.Equal(t, map[string]Instance{
+		"dns:tcp:53:host":     {ID: "dns:tcp:53:host", Name: "dns", IP: "10.0.0.2", Port: 53, Proto: "tcp"},
+		"dns-udp:udp:53:host": {ID: "dns-udp:udp:53:host", Name: "dns-udp", IP: "10.0.0.2", Port: 53, Proto: "udp"},
+	}, srv.Instances())
+}
+
+func TestProtocolUnknown(t *testing.T) {
+	container := newProtocolContainer(map[string]string{"com.github.njasm.clerk.proto.naming": "color"})
+	container.ExposedPorts = []string{"53/quic", "3868/sctp"}
+
+	srv := NewFrom(container)
+
+	assert.Equal(t, map[string]Instance{
+		"dns:sctp:3868:host": {ID: "dns:sctp:3868:host", Name: "dns", IP: "10.0.0.2", Port: 3868, Proto: "sctp"},
+	}, srv.Instances())
+	assert.ErrorIs(t, srv.Errors()[0], ErrProtocol)
+	assert.Len(t, srv.Diagnostics(), 1)
+}
+
+func TestInstanceProtocol(t *testing.T) {
+	assert.True(t, Instance{Proto: "tcp"}.TCP())
+	assert.True(t, Instance{}.TCP())
+	assert.False(t, Instance{Proto: "udp"}.TCP())
+	assert.True(t, Instance{Proto: "udp"}.UDP())
+	assert.False(t, Instance{Proto: "sctp"}.UDP())
+}
+
+func TestSkippedChecksDiagnostics(t *testing.T) {
+	srv := NewFrom(Container{
+		Name: "dns",
+		Labels: map[string]string{
+			"com.github.njasm.clerk.ports":             "53/udp,53/tcp,3868/sctp",
+			"com.github.njasm.clerk.consul.check.http": "/health",
+			"com.github.njasm.clerk.consul.check.udp":  "true",
+		},
+		Networks: map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	})
+
+	assert.Equal(t, 53, srv.CheckPort())
+	assert.Equal(t, []Diagnostic{
+		{Label: "com.github.njasm.clerk.consul.check.http", Severity: SEVERITY_WARNING, Message: "check skipped on sctp and udp ports, not supported"},
+		{Label: "com.github.njasm.clerk.consul.check.udp", Severity: SEVERITY_WARNING, Message: "check skipped on sctp and tcp ports, not supported"},
+	}, srv.Diagnostics())
+}
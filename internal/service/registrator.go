@@ -0,0 +1,211 @@
+package service
+
+import (
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/njasm/clerk/internal/constants"
+	"github.com/njasm/clerk/internal/utils"
+)
+
+// CLERK_REGISTRATOR_COMPAT=true reads the gliderlabs/registrator SERVICE_ metadata of
+// containers. Precedence, highest first: clerk labels, SERVICE_<port>_X labels,
+// SERVICE_<port>_X environment variables, SERVICE_X labels, SERVICE_X environment
+// variables and the clerk global defaults.
+const envRegistratorCompat = "CLERK_REGISTRATOR_COMPAT"
+
+const registratorPrefix = "SERVICE_"
+
+// registratorKeys maps the registrator metadata keys clerk understands to their clerk config key.
+// Any other metadata key becomes an attribute, as registrator does.
+var registratorKeys = map[string]string{
+	"name":                   constants.CONFIG_SERVICE_NAME,
+	"tags":                   constants.CONFIG_SERVICE_TAGS,
+	"id":                     constants.CONFIG_INSTANCE_ID,
+	"check_http":             constants.CONFIG_PREFIX + "consul.check.http",
+	"check_https":            constants.CONFIG_PREFIX + "consul.check.https",
+	"check_tcp":              constants.CONFIG_PREFIX + "consul.check.tcp",
+	"check_interval":         constants.CONFIG_PREFIX + "consul.check.interval",
+	"check_timeout":          constants.CONFIG_PREFIX + "consul.check.timeout",
+	"check_deregister_after": constants.CONFIG_PREFIX + "consul.check.deregister.after",
+}
+
+// registratorPortKey matches the port specific metadata keys, like 80_name.
+var registratorPortKey = regexp.MustCompile(`^([0-9]+)_(.+)$`)
+
+// registratorPortKeys are the port specific metadata keys clerk understands, the others,
+// like the port checks, are reported as unsupported.
+var registratorPortKeys = map[string]bool{
+	"name":   true,
+	"id":     true,
+	"tags":   true,
+	"ignore": true,
+}
+
+// registratorMetadata is the registrator configuration of a container, read from its
+// SERVICE_ environment variables and labels.
+type registratorMetadata struct {
+	service map[string]string
+	ports   map[string]map[string]string
+}
+
+// readRegistratorMetadata returns the SERVICE_ metadata of the container, labels override
+// environment variables, or nil when the compatibility mode is off or there is none.
+func (s *Service) readRegistratorMetadata() *registratorMetadata {
+	if !utils.EnvBool(envRegistratorCompat) {
+		return nil
+	}
+
+	rv := &registratorMetadata{
+		service: map[string]string{},
+		ports:   map[string]map[string]string{},
+	}
+
+	found := false
+	add := func(key, value string) {
+		if !strings.HasPrefix(key, registratorPrefix) {
+			return
+		}
+
+		found = true
+		key = strings.ToLower(strings.TrimPrefix(key, registratorPrefix))
+		if match := registratorPortKey.FindStringSubmatch(key); match != nil {
+			if _, ok := rv.ports[match[1]]; !ok {
+				rv.ports[match[1]] = map[string]string{}
+			}
+
+			rv.ports[match[1]][match[2]] = value
+			return
+		}
+
+		rv.service[key] = value
+	}
+
+	for _, value := range s.container.Env {
+		if key, value, ok := strings.Cut(value, "="); ok {
+			add(key, value)
+		}
+	}
+
+	for key, value := range s.container.Labels {
+		add(key, value)
+	}
+
+	if !found {
+		return nil
+	}
+
+	return rv
+}
+
+// setRegistratorConfig completes the config of the service with its registrator metadata.
+// Clerk labels always take precedence, a container with registrator metadata is registered
+// unless it has SERVICE_IGNORE or a clerk register label.
+func (s *Service) setRegistratorConfig() *Service {
+	s.registrator = s.readRegistratorMetadata()
+	if s.registrator == nil {
+		return s
+	}
+
+	if _, ok := s.config[constants.CONFIG_CLERK_REGISTER]; !ok {
+		s.config[constants.CONFIG_CLERK_REGISTER] = "true"
+		if _, ignore := s.registrator.service["ignore"]; ignore {
+			s.config[constants.CONFIG_CLERK_REGISTER] = "false"
+		}
+	}
+
+	for key, value := range s.registrator.service {
+		configKey, ok := registratorKeys[key]
+		if !ok {
+			continue
+		}
+
+		if _, ok := s.config[configKey]; !ok {
+			s.config[configKey] = value
+			s.fromRegistrator[configKey] = true
+		}
+	}
+
+	s.diagnoseRegistratorPorts()
+
+	return s
+}
+
+// diagnoseRegistratorPorts reports the port specific metadata clerk ignores.
+func (s *Service) diagnoseRegistratorPorts() {
+	ports := []string{}
+	for port := range s.registrator.ports {
+		ports = append(ports, port)
+	}
+
+	sort.Strings(ports)
+	for _, port := range ports {
+		keys := []string{}
+		for key := range s.registrator.ports[port] {
+			if !registratorPortKeys[key] {
+				keys = append(keys, key)
+			}
+		}
+
+		sort.Strings(keys)
+		for _, key := range keys {
+			s.diagnostics = append(s.diagnostics, Diagnostic{
+				Label:    registratorPrefix + port + "_" + strings.ToUpper(key),
+				Severity: SEVERITY_WARNING,
+				Message:  "not supported per port, ignored",
+			})
+		}
+	}
+}
+
+// registratorAttributes returns the metadata registrator publishes as attributes.
+func (s *Service) registratorAttributes() map[string]string {
+	rv := map[string]string{}
+	if s.registrator == nil {
+		return rv
+	}
+
+	for key, value := range s.registrator.service {
+		if _, ok := registratorKeys[key]; !ok && key != "ignore" {
+			rv[key] = value
+		}
+	}
+
+	return rv
+}
+
+// registratorPortTags returns the SERVICE_<port>_TAGS of port, which replace the service tags.
+func (s *Service) registratorPortTags(port int) ([]string, bool) {
+	text, ok := s.registratorPort(strconv.Itoa(port), "tags")
+	if !ok {
+		return nil, false
+	}
+
+	tags := []string{}
+	for _, tag := range strings.Split(text, ",") {
+		if tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags, true
+}
+
+// registratorPort returns the port specific metadata key of port, unless the matching
+// clerk label is set on the container.
+func (s *Service) registratorPort(port, key string) (string, bool) {
+	if s.registrator == nil {
+		return "", false
+	}
+
+	if configKey, ok := registratorKeys[key]; ok {
+		if _, ok := s.config[configKey]; ok && !s.fromRegistrator[configKey] {
+			return "", false
+		}
+	}
+
+	value, ok := s.registrator.ports[port][key]
+	return value, ok
+}
@@ -0,0 +1,127 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newRegistratorContainer(env []string, labels map[string]string) Container {
+	if labels == nil {
+		labels = map[string]string{}
+	}
+
+	return Container{
+		ID:           "abc123",
+		Name:         "web",
+		Hostname:     "host",
+		Env:          env,
+		Labels:       labels,
+		ExposedPorts: []string{"80/tcp", "9090/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	}
+}
+
+func TestRegistratorCompatDisabled(t *testing.T) {
+	srv := NewFrom(newRegistratorContainer([]string{"SERVICE_NAME=api"}, nil))
+
+	assert.Equal(t, "web", srv.Name())
+	assert.False(t, registered(t, srv))
+}
+
+func TestRegistratorCompat(t *testing.T) {
+	t.Setenv(envRegistratorCompat, "true")
+
+	srv := NewFrom(newRegistratorContainer([]string{
+		"SERVICE_NAME=api",
+		"SERVICE_TAGS=primary,v2",
+		"SERVICE_9090_NAME=api-metrics",
+		"SERVICE_CHECK_HTTP=/health",
+		"SERVICE_CHECK_TIMEOUT=3s",
+		"SERVICE_REGION=eu-west-1",
+		"PATH=/usr/bin",
+	}, nil))
+
+	assert.True(t, registered(t, srv))
+	assert.Equal(t, "api", srv.Name())
+	assert.Equal(t, []string{"primary", "v2"}, srv.Tags())
+	assert.Equal(t, map[string]string{"region": "eu-west-1"}, srv.Attributes())
+
+	check, _ := srv.GetConfig("consul.check.http")
+	assert.Equal(t, "/health", check)
+	timeout, _ := srv.GetConfig("consul.check.timeout")
+	assert.Equal(t, "3s", timeout)
+
+	assert.Equal(t, map[string]Instance{
+		"api:tcp:80:host":           {ID: "api:tcp:80:host", Name: "api", IP: "10.0.0.2", Port: 80, Proto: "tcp"},
+		"api-metrics:tcp:9090:host": {ID: "api-metrics:tcp:9090:host", Name: "api-metrics", IP: "10.0.0.2", Port: 9090, Proto: "tcp"},
+	}, srv.Instances())
+}
+
+func TestRegistratorCompatPrecedence(t *testing.T) {
+	t.Setenv(envRegistratorCompat, "true")
+
+	// clerk labels win over registrator labels, which win over registrator environment variables
+	srv := NewFrom(newRegistratorContainer(
+		[]string{"SERVICE_NAME=from-env", "SERVICE_TAGS=from-env", "SERVICE_9090_NAME=metrics"},
+		map[string]string{
+			"SERVICE_TAGS":                "from-label",
+			"com.github.njasm.clerk.name": "from-clerk",
+		},
+	))
+
+	assert.Equal(t, "from-clerk", srv.Name())
+	assert.Equal(t, []string{"from-label"}, srv.Tags())
+	assert.Contains(t, srv.Instances(), "from-clerk:tcp:9090:host")
+}
+
+func TestRegistratorCompatIgnore(t *testing.T) {
+	t.Setenv(envRegistratorCompat, "true")
+
+	srv := NewFrom(newRegistratorContainer([]string{"SERVICE_NAME=api", "SERVICE_IGNORE=true"}, nil))
+	assert.False(t, registered(t, srv))
+
+	srv = NewFrom(newRegistratorContainer([]string{"SERVICE_NAME=api", "SERVICE_9090_IGNORE=true", "SERVICE_80_ID=api-1"}, nil))
+	assert.True(t, registered(t, srv))
+	assert.Equal(t, []string{"api-1"}, keys(srv.Instances()))
+}
+
+func TestRegistratorCompatWithoutMetadata(t *testing.T) {
+	t.Setenv(envRegistratorCompat, "true")
+
+	srv := NewFrom(newRegistratorContainer([]string{"PATH=/usr/bin"}, nil))
+	assert.False(t, registered(t, srv))
+}
+
+func keys(instances map[string]Instance) []string {
+	rv := []string{}
+	for key := range instances {
+		rv = append(rv, key)
+	}
+
+	return rv
+}
+
+func TestRegistratorCompatPortMetadata(t *testing.T) {
+	t.Setenv(envRegistratorCompat, "true")
+
+	srv := NewFrom(newRegistratorContainer([]string{
+		"SERVICE_NAME=api",
+		"SERVICE_TAGS=primary",
+		"SERVICE_9090_TAGS=metrics,internal",
+		"SERVICE_9090_CHECK_HTTP=/metrics",
+		"SERVICE_80_CHECK_INTERVAL=5s",
+	}, nil))
+
+	assert.Equal(t, []string{"primary"}, srv.InstanceTags(srv.Instances()["api:tcp:80:host"]))
+	assert.Equal(t, []string{"metrics", "internal"}, srv.InstanceTags(srv.Instances()["api:tcp:9090:host"]))
+
+	assert.Equal(t, []Diagnostic{
+		{Label: "SERVICE_80_CHECK_INTERVAL", Severity: SEVERITY_WARNING, Message: "not supported per port, ignored"},
+		{Label: "SERVICE_9090_CHECK_HTTP", Severity: SEVERITY_WARNING, Message: "not supported per port, ignored"},
+	}, srv.Diagnostics())
+
+	// the clerk tags label wins over the port tags
+	srv = NewFrom(newRegistratorContainer([]string{"SERVICE_9090_TAGS=metrics"}, map[string]string{"com.github.njasm.clerk.tags": "clerk"}))
+	assert.Equal(t, []string{"clerk"}, srv.InstanceTags(srv.Instances()["web:tcp:9090:host"]))
+}
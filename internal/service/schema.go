@@ -0,0 +1,263 @@
+package service
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/njasm/clerk/internal/constants"
+)
+
+// LabelType is the type of the value of a label.
+type LabelType string
+
+const (
+	LABEL_STRING   LabelType = "string"
+	LABEL_BOOL     LabelType = "bool"
+	LABEL_DURATION LabelType = "duration"
+	LABEL_INT      LabelType = "int"
+	// comma separated values
+	LABEL_LIST LabelType = "list"
+	// comma separated key:value pairs, or a JSON object
+	LABEL_MAP LabelType = "map"
+)
+
+// LabelSpec describes a supported label, by its key without the label prefix.
+type LabelSpec struct {
+	Key  string
+	Type LabelType
+	// Values, when set, are the only accepted values
+	Values []string
+	// Prefix specs match every key starting with Key, like kv.
+	Prefix bool
+}
+
+type Severity string
+
+const (
+	SEVERITY_WARNING Severity = "warning"
+	SEVERITY_ERROR   Severity = "error"
+)
+
+// Diagnostic is a problem found in the labels of a container.
+type Diagnostic struct {
+	Label    string
+	Severity Severity
+	Message  string
+}
+
+func (d Diagnostic) String() string {
+	return fmt.Sprintf("%s: %s: %s", d.Severity, d.Label, d.Message)
+}
+
+// labelSchema is every label clerk understands.
+var labelSchema = []LabelSpec{
+	{Key: "register", Type: LABEL_BOOL},
+	{Key: "name", Type: LABEL_STRING},
+	{Key: "id", Type: LABEL_STRING},
+	{Key: "ports", Type: LABEL_LIST},
+	{Key: "tags", Type: LABEL_LIST},
+	{Key: "attributes", Type: LABEL_MAP},
+	{Key: "attributes.", Type: LABEL_STRING, Prefix: true},
+	{Key: "naming", Type: LABEL_STRING, Values: []string{NAMING_CONTAINER, NAMING_COMPOSE, NAMING_COMPOSE_PROJECT}},
+	{Key: "address.family", Type: LABEL_STRING, Values: []string{FAMILY_IPV4, FAMILY_IPV6, FAMILY_BOTH, FAMILY_DUAL}},
+	{Key: "advertise.address", Type: LABEL_LIST},
+	{Key: "proto.naming", Type: LABEL_STRING, Values: []string{PROTOCOL_NONE, PROTOCOL_TAG, PROTOCOL_NAME}},
+	{Key: "swarm.publish", Type: LABEL_STRING, Values: []string{"overlay", "ingress"}},
+	{Key: "kv.", Type: LABEL_STRING, Prefix: true},
+	{Key: "consul.check.http", Type: LABEL_STRING},
+	{Key: "consul.check.https", Type: LABEL_STRING},
+	{Key: "consul.check.method", Type: LABEL_STRING, Values: []string{"GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"}},
+	{Key: "consul.check.tcp", Type: LABEL_BOOL},
+	{Key: "consul.check.grpc", Type: LABEL_BOOL},
+	{Key: "consul.check.udp", Type: LABEL_BOOL},
+	{Key: "consul.check.grpc.tls", Type: LABEL_BOOL},
+	{Key: "consul.check.tls.skip.verify", Type: LABEL_BOOL},
+	{Key: "consul.check.timeout", Type: LABEL_DURATION},
+	{Key: "consul.check.interval", Type: LABEL_DURATION},
+	{Key: "consul.check.deregister.after", Type: LABEL_DURATION},
+}
+
+// labelAliases are deprecated keys still accepted for the key they map to.
+var labelAliases = map[string]string{
+	"consul.check.timout":    "consul.check.timeout",
+	"consule.check.grpc.tls": "consul.check.grpc.tls",
+}
+
+// Schema returns the supported labels, sorted by key.
+func Schema() []LabelSpec {
+	rv := append([]LabelSpec{}, labelSchema...)
+	sort.Slice(rv, func(i, j int) bool { return rv[i].Key < rv[j].Key })
+
+	return rv
+}
+
+func lookupSpec(key string) (LabelSpec, bool) {
+	for _, spec := range labelSchema {
+		if spec.Key == key || (spec.Prefix && strings.HasPrefix(key, spec.Key)) {
+			return spec, true
+		}
+	}
+
+	return LabelSpec{}, false
+}
+
+// Diagnostics returns the problems found in the labels of the container.
+func (s *Service) Diagnostics() []Diagnostic {
+	return s.diagnostics
+}
+
+// normaliseConfig moves the deprecated aliases to their key, the key wins when both are set.
+func (s *Service) normaliseConfig() *Service {
+	for alias, key := range labelAliases {
+		value, ok := s.config[constants.CONFIG_PREFIX+alias]
+		if !ok {
+			continue
+		}
+
+		delete(s.config, constants.CONFIG_PREFIX+alias)
+		s.diagnose(alias, SEVERITY_WARNING, "deprecated, use %s", LabelPrefix()+key)
+		if _, exists := s.config[constants.CONFIG_PREFIX+key]; !exists {
+			s.config[constants.CONFIG_PREFIX+key] = value
+		}
+	}
+
+	return s
+}
+
+// validate checks every config entry against the label schema.
+func (s *Service) validate() *Service {
+	keys := []string{}
+	for key := range s.config {
+		keys = append(keys, key)
+	}
+
+	sort.Strings(keys)
+	for _, configKey := range keys {
+		key := strings.TrimPrefix(configKey, constants.CONFIG_PREFIX)
+		spec, ok := lookupSpec(key)
+		if !ok {
+			if suggestion := suggest(key); suggestion != "" {
+				s.diagnose(key, SEVERITY_WARNING, "unknown label, did you mean %s?", LabelPrefix()+suggestion)
+			} else {
+				s.diagnose(key, SEVERITY_WARNING, "unknown label")
+			}
+
+			continue
+		}
+
+		if err := spec.check(s.config[configKey]); err != nil {
+			s.diagnose(key, SEVERITY_ERROR, "%v", err)
+		}
+	}
+
+	s.diagnoseChecks()
+
+	return s
+}
+
+func (s *Service) diagnose(key string, severity Severity, format string, args ...interface{}) {
+	s.diagnostics = append(s.diagnostics, Diagnostic{
+		Label:    LabelPrefix() + key,
+		Severity: severity,
+		Message:  fmt.Sprintf(format, args...),
+	})
+}
+
+// check validates value against the spec type and values, templates are checked once rendered.
+func (spec LabelSpec) check(value string) error {
+	if strings.Contains(value, "{{") {
+		return nil
+	}
+
+	value = strings.TrimSpace(value)
+	switch spec.Type {
+	case LABEL_BOOL:
+		if _, err := strconv.ParseBool(value); err != nil {
+			return fmt.Errorf("%q is not a bool", value)
+		}
+	case LABEL_DURATION:
+		if _, err := time.ParseDuration(value); err != nil {
+			return fmt.Errorf("%q is not a duration, like 10s", value)
+		}
+	case LABEL_INT:
+		if _, err := strconv.Atoi(value); err != nil {
+			return fmt.Errorf("%q is not an int", value)
+		}
+	case LABEL_LIST:
+		for _, item := range strings.Split(value, ",") {
+			if strings.TrimSpace(item) == "" {
+				return fmt.Errorf("%q has an empty item", value)
+			}
+		}
+	case LABEL_MAP:
+		if _, err := parseAttributes(value); err != nil {
+			return fmt.Errorf("%q: %v", value, err)
+		}
+	}
+
+	if len(spec.Values) == 0 {
+		return nil
+	}
+
+	for _, valid := range spec.Values {
+		if strings.EqualFold(valid, value) {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("%q is not one of %s", value, strings.Join(spec.Values, ", "))
+}
+
+// suggest returns the supported key closest to key, if close enough to be a typo.
+func suggest(key string) string {
+	best, distance := "", len(key)/3+1
+	for _, spec := range labelSchema {
+		if spec.Prefix {
+			continue
+		}
+
+		if d := levenshtein(key, spec.Key); d <= distance {
+			best, distance = spec.Key, d
+		}
+	}
+
+	return best
+}
+
+func levenshtein(a, b string) int {
+	previous := make([]int, len(b)+1)
+	current := make([]int, len(b)+1)
+	for j := range previous {
+		previous[j] = j
+	}
+
+	for i := 1; i <= len(a); i++ {
+		current[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+
+			current[j] = minInt(previous[j]+1, current[j-1]+1, previous[j-1]+cost)
+		}
+
+		previous, current = current, previous
+	}
+
+	return previous[len(b)]
+}
+
+func minInt(values ...int) int {
+	rv := values[0]
+	for _, v := range values[1:] {
+		if v < rv {
+			rv = v
+		}
+	}
+
+	return rv
+}
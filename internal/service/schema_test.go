@@ -0,0 +1,94 @@
+package service
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newSchemaContainer(labels map[string]string) Container {
+	return Container{
+		Name:         "web",
+		Hostname:     "host",
+		Labels:       labels,
+		ExposedPorts: []string{"80/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	}
+}
+
+func TestSchemaValidLabels(t *testing.T) {
+	srv := NewFrom(newSchemaContainer(map[string]string{
+		"com.github.njasm.clerk.register":              "true",
+		"com.github.njasm.clerk.tags":                  "a,b",
+		"com.github.njasm.clerk.consul.check.interval": "10s",
+		"com.github.njasm.clerk.consul.check.method":   "head",
+		"com.github.njasm.clerk.kv.some/key":           "value",
+		"com.github.njasm.clerk.name":                  "{{ .Container.Name }}",
+	}))
+
+	assert.Empty(t, srv.Diagnostics())
+}
+
+func TestSchemaDeprecatedAlias(t *testing.T) {
+	srv := NewFrom(newSchemaContainer(map[string]string{
+		"com.github.njasm.clerk.consul.check.timout":    "2s",
+		"com.github.njasm.clerk.consule.check.grpc.tls": "true",
+	}))
+
+	timeout, _ := srv.GetConfig("consul.check.timeout")
+	assert.Equal(t, "2s", timeout)
+	tls, _ := srv.GetConfig("consul.check.grpc.tls")
+	assert.Equal(t, "true", tls)
+
+	_, ok := srv.GetConfig("consul.check.timout")
+	assert.False(t, ok)
+
+	assert.ElementsMatch(t, []Diagnostic{
+		{Label: "com.github.njasm.clerk.consul.check.timout", Severity: SEVERITY_WARNING, Message: "deprecated, use com.github.njasm.clerk.consul.check.timeout"},
+		{Label: "com.github.njasm.clerk.consule.check.grpc.tls", Severity: SEVERITY_WARNING, Message: "deprecated, use com.github.njasm.clerk.consul.check.grpc.tls"},
+	}, srv.Diagnostics())
+}
+
+func TestSchemaUnknownLabels(t *testing.T) {
+	srv := NewFrom(newSchemaContainer(map[string]string{
+		"com.github.njasm.clerk.consul.check.intervl": "10s",
+		"com.github.njasm.clerk.something":            "else",
+	}))
+
+	assert.Equal(t, []Diagnostic{
+		{Label: "com.github.njasm.clerk.consul.check.intervl", Severity: SEVERITY_WARNING, Message: "unknown label, did you mean com.github.njasm.clerk.consul.check.interval?"},
+		{Label: "com.github.njasm.clerk.something", Severity: SEVERITY_WARNING, Message: "unknown label"},
+	}, srv.Diagnostics())
+}
+
+func TestSchemaTypeErrors(t *testing.T) {
+	srv := NewFrom(newSchemaContainer(map[string]string{
+		"com.github.njasm.clerk.register":              "yes please",
+		"com.github.njasm.clerk.consul.check.interval": "10",
+		"com.github.njasm.clerk.naming":                "random",
+		"com.github.njasm.clerk.tags":                  "a,,b",
+	}))
+
+	assert.Equal(t, []Diagnostic{
+		{Label: "com.github.njasm.clerk.consul.check.interval", Severity: SEVERITY_ERROR, Message: `"10" is not a duration, like 10s`},
+		{Label: "com.github.njasm.clerk.naming", Severity: SEVERITY_ERROR, Message: `"random" is not one of container, compose, compose-project`},
+		{Label: "com.github.njasm.clerk.register", Severity: SEVERITY_ERROR, Message: `"yes please" is not a bool`},
+		{Label: "com.github.njasm.clerk.tags", Severity: SEVERITY_ERROR, Message: `"a,,b" has an empty item`},
+	}, srv.Diagnostics())
+}
+
+func TestSchemaStrictPolicy(t *testing.T) {
+	srv := NewFrom(newSchemaContainer(map[string]string{
+		"com.github.njasm.clerk.register":              "true",
+		"com.github.njasm.clerk.consul.check.interval": "often",
+	}))
+
+	policy, err := NewPolicy()
+	assert.Nil(t, err)
+	assert.True(t, policy.Register(srv))
+
+	t.Setenv(envLabelStrict, "true")
+	policy, err = NewPolicy()
+	assert.Nil(t, err)
+	assert.False(t, policy.Register(srv))
+}
@@ -6,15 +6,16 @@ import (
 	"strconv"
 	"strings"
 
-	"github.com/docker/docker/api/types"
 	"github.com/docker/go-connections/nat"
 	"github.com/njasm/clerk/internal/constants"
 )
 
 type RegisteredService struct {
-	ID         string
-	Name       string
-	IP         string
+	ID   string
+	Name string
+	IP   string
+	// IPv6 is the IPv6 address of an instance of the FAMILY_DUAL address family
+	IPv6       string
 	Port       int
 	Proto      string
 	Tags       []string
@@ -23,42 +24,69 @@ type RegisteredService struct {
 }
 
 type Service struct {
-	id         string
-	name       string
-	tags       []string
-	attributes map[string]string
-	config     map[string]string
-	container  types.ContainerJSON
-	instances  map[string]Instance
+	id          string
+	name        string
+	tags        []string
+	attributes  map[string]string
+	config      map[string]string
+	container   Container
+	replica     string
+	family      string
+	protoNaming string
+	host        *Advertised
+	hostErr     error
+	advertised  bool
+	instances   map[string]Instance
+	errors      []error
+
+	diagnostics []Diagnostic
+
+	registrator     *registratorMetadata
+	fromRegistrator map[string]bool
 }
 
 type Instance struct {
 	ID    string
+	Name  string
 	IP    string
 	Port  int
 	Proto string
+	// IPv6 is the IPv6 address of an instance of the FAMILY_DUAL address family
+	IPv6 string
+
+	// missing is set on the instances without an address of their family
+	missing bool
 }
 
-func NewFrom(container types.ContainerJSON) *Service {
+func NewFrom(container Container) *Service {
 	srv := &Service{
 		tags:       []string{},
 		attributes: map[string]string{},
 		config:     map[string]string{},
 		container:  container,
 		instances:  map[string]Instance{},
+
+		fromRegistrator: map[string]bool{},
 	}
 
 	return srv.setConfig().
+		normaliseConfig().
+		setRegistratorConfig().
 		setServiceName().
 		setTags().
 		setAttributes().
-		setInstances()
+		setInstances().
+		validate()
 }
 
 func (s *Service) ID() string {
 	return s.id
 }
 
+func (s *Service) ContainerID() string {
+	return s.container.ID
+}
+
 func (s *Service) Name() string {
 	return s.name
 }
@@ -95,6 +123,8 @@ func (s *Service) GetConfig(keySuffix string) (string, bool) {
 	var key string
 	if strings.HasPrefix(keySuffix, constants.CONFIG_PREFIX) {
 		key = keySuffix
+	} else if configKey, ok := configKey(keySuffix, LabelPrefix()); ok {
+		key = configKey
 	} else {
 		key = constants.CONFIG_PREFIX + keySuffix
 	}
@@ -104,6 +134,23 @@ func (s *Service) GetConfig(keySuffix string) (string, bool) {
 	return data, ok
 }
 
+// ConfigWithPrefix returns every config entry under the given key prefix,
+// keyed by what is left of the label key once the prefix is removed.
+func (s *Service) ConfigWithPrefix(keyPrefix string) map[string]string {
+	if !strings.HasPrefix(keyPrefix, constants.CONFIG_PREFIX) {
+		keyPrefix = constants.CONFIG_PREFIX + keyPrefix
+	}
+
+	rv := map[string]string{}
+	for key, value := range s.config {
+		if suffix := strings.TrimPrefix(key, keyPrefix); suffix != key && suffix != "" {
+			rv[suffix] = value
+		}
+	}
+
+	return rv
+}
+
 func (s *Service) Tags() []string {
 	return s.tags
 }
@@ -118,38 +165,35 @@ func (s *Service) GetAttribute(key string) (string, bool) {
 	return data, ok
 }
 
+// Instances returns every instance of the service, the ones without address included,
+// which are only unregistered.
 func (s *Service) Instances() map[string]Instance {
 	return s.instances
 }
 
-func (s *Service) Register() bool {
-	data, exist := s.GetConfig(constants.CONFIG_CLERK_REGISTER)
-	if !exist {
-		return false
-	}
-
-	// if we have no instances, then there's
-	// no network address nor port defined
-	if len(s.instances) == 0 {
-		return false
+// Addressed returns the service with the instances that have an address, the ones to register.
+func (s *Service) Addressed() *Service {
+	rv := *s
+	rv.instances = map[string]Instance{}
+	for id, instance := range s.instances {
+		if !instance.missing {
+			rv.instances[id] = instance
+		}
 	}
 
-	if trimAndLowerString(data) == "true" {
-		return true
-	}
+	return &rv
+}
 
-	return false
+// Errors returns what went wrong building the service from its container, like template errors.
+func (s *Service) Errors() []error {
+	return s.errors
 }
 
 func (s *Service) setConfig() *Service {
 	config := map[string]string{}
-	if s.container.Config == nil {
-		return s
-	}
-
-	for key, value := range s.container.Config.Labels {
-		key = trimAndLowerString(key)
-		if strings.HasPrefix(key, constants.CONFIG_PREFIX) {
+	prefix := LabelPrefix()
+	for key, value := range s.container.Labels {
+		if key, ok := configKey(trimAndLowerString(key), prefix); ok {
 			config[key] = value
 		}
 	}
@@ -159,39 +203,34 @@ func (s *Service) setConfig() *Service {
 }
 
 func (s *Service) setServiceName() *Service {
-	name, ok := s.GetConfig(constants.CONFIG_SERVICE_NAME)
-	if ok {
+	strategy := s.namingStrategy()
+	composeName, replica, compose := s.composeName(strategy == NAMING_COMPOSE_PROJECT)
+	compose = compose && (strategy == NAMING_COMPOSE || strategy == NAMING_COMPOSE_PROJECT)
+	if compose {
+		s.replica = replica
+	}
+
+	name, ok := s.renderConfig(constants.CONFIG_SERVICE_NAME, envServiceNameTemplate, s.templateData(s.primaryPort()))
+	if ok && name != "" {
 		s.name = strings.TrimLeft(name, "/")
 		return s
 	}
 
-	s.name = strings.TrimLeft(s.container.Name, "/")
-	return s
-}
-
-func (s *Service) setTags() *Service {
-	tags, ok := s.GetConfig(constants.CONFIG_SERVICE_TAGS)
-	if ok {
-		s.tags = append(s.tags, strings.Split(tags, ",")...)
+	if compose {
+		s.name = composeName
+		return s
 	}
 
+	s.name = strings.TrimLeft(s.container.Name, "/")
 	return s
 }
 
-func (s *Service) setAttributes() *Service {
-	attrs, ok := s.GetConfig(constants.CONFIG_SERVICE_ATTRIBUTES)
+func (s *Service) setTags() *Service {
+	tags, ok := s.renderConfig(constants.CONFIG_SERVICE_TAGS, envServiceTags, s.templateData(s.primaryPort()))
 	if ok {
-		for _, value := range strings.Split(attrs, ",") {
-			data := strings.Split(value, ":")
-			key := ""
-			for _, val := range data {
-				if key == "" {
-					key = val
-					continue
-				}
-
-				s.attributes[key] = val
-				key = ""
+		for _, tag := range strings.Split(tags, ",") {
+			if tag != "" {
+				s.tags = append(s.tags, tag)
 			}
 		}
 	}
@@ -200,22 +239,20 @@ func (s *Service) setAttributes() *Service {
 }
 
 func (s *Service) setInstances() *Service {
-	// if we have explicit ports defined, use those
-	ports, ok := s.GetConfig(constants.CONFIG_SERVICE_PORTS)
-	if ports != "" && ok {
-		for _, portProtoPair := range strings.Split(ports, ",") {
-			err := instance(s, portProtoPair)
-			if err != nil {
-				fmt.Println(fmt.Errorf("error: %w", err))
-				continue
-			}
+	s.family = s.addressFamily()
+	s.protoNaming = s.protocolNaming()
+	if s.container.HostNetwork {
+		if _, err := s.advertiseAddresses(); err != nil {
+			s.errors = append(s.errors, err)
 		}
 
-		return s
+		// host network containers publish nothing, their ports are the ones of the label
+		if len(s.ports()) == 0 {
+			s.errors = append(s.errors, fmt.Errorf("%w: host network container without ports, set %s", ErrAddress, LabelPrefix()+"ports"))
+		}
 	}
 
-	for portProtoPair := range s.container.Config.ExposedPorts {
-		rawPort := string(portProtoPair)
+	for _, rawPort := range s.ports() {
 		err := instance(s, rawPort)
 		if err != nil {
 			fmt.Println(fmt.Errorf("error: %w", err))
@@ -226,8 +263,29 @@ func (s *Service) setInstances() *Service {
 	return s
 }
 
+// ports returns the port/proto pairs to register, the explicit ones if defined and the exposed ones otherwise.
+func (s *Service) ports() []string {
+	ports, ok := s.GetConfig(constants.CONFIG_SERVICE_PORTS)
+	if ports != "" && ok {
+		return strings.Split(ports, ",")
+	}
+
+	return s.container.ExposedPorts
+}
+
+// primaryPort returns the port and proto of the first valid port.
+func (s *Service) primaryPort() (int, string) {
+	for _, rawPort := range s.ports() {
+		proto, port := nat.SplitProtoPort(rawPort)
+		if intPort, err := strconv.Atoi(port); err == nil {
+			return intPort, proto
+		}
+	}
+
+	return 0, ""
+}
+
 var ErrAtoi = errors.New("converting to int")
-var ErrNoNetworkEndpointSettings = errors.New("no network endpoint settings")
 
 func instance(s *Service, rawPort string) error {
 	proto, port := nat.SplitProtoPort(rawPort)
@@ -236,25 +294,54 @@ func instance(s *Service, rawPort string) error {
 		return ErrAtoi
 	}
 
-	serviceID := fmt.Sprintf("%v:%v:%v:%v", s.name, proto, port, s.container.Config.Hostname)
-	for _, networkValue := range s.container.NetworkSettings.Networks {
-		if networkValue == nil {
-			return ErrNoNetworkEndpointSettings
-		}
+	proto, err = protocol(proto)
+	if err != nil {
+		return err
+	}
 
-		// set Service ID to the first instance ID
-		if s.id == "" {
-			s.id = serviceID
-		}
+	if _, ignore := s.registratorPort(port, "ignore"); ignore {
+		return nil
+	}
 
-		s.instances[serviceID] = Instance{
-			ID:    serviceID,
-			IP:    networkValue.IPAddress,
-			Port:  intPort,
-			Proto: proto,
-		}
+	name := s.name
+	if portName, ok := s.registratorPort(port, "name"); ok && portName != "" {
+		name = portName
+	}
+
+	name = s.protocolName(name, proto)
+
+	// a Compose replica keeps its number when recreated, see replicaHost. A Swarm task
+	// keeps its ID wherever it runs and a rescheduled task gets a new one
+	host := s.container.Hostname
+	if s.replica != "" {
+		host = s.replicaHost()
 	}
 
+	if taskID, ok := s.container.Labels[constants.SWARM_TASK_ID]; ok && taskID != "" {
+		host = taskID
+	}
+
+	serviceID := fmt.Sprintf("%v:%v:%v:%v", name, proto, port, host)
+	data := s.templateData(intPort, proto)
+	data.Name = name
+	id, ok := s.renderConfig(constants.CONFIG_INSTANCE_ID, envInstanceIDTemplate, data)
+	if portID, found := s.registratorPort(port, "id"); found {
+		id, ok = portID, true
+	}
+
+	if _, exists := s.instances[id]; ok && exists {
+		s.errors = append(s.errors, fmt.Errorf("%w: %s: %s is the ID of more than one instance", ErrTemplate, constants.CONFIG_INSTANCE_ID, id))
+	} else if ok && id != "" {
+		serviceID = id
+	}
+
+	s.addInstances(Instance{
+		ID:    serviceID,
+		Name:  name,
+		Port:  intPort,
+		Proto: proto,
+	})
+
 	return nil
 }
 
@@ -0,0 +1,162 @@
+package service
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/template"
+)
+
+// Global defaults, used by containers without the matching label.
+const (
+	envServiceNameTemplate = "CLERK_SERVICE_NAME_TEMPLATE"
+	envInstanceIDTemplate  = "CLERK_INSTANCE_ID_TEMPLATE"
+	envServiceTags         = "CLERK_SERVICE_TAGS"
+	envServiceAttributes   = "CLERK_SERVICE_ATTRIBUTES"
+)
+
+var ErrTemplate = errors.New("template error")
+
+// templateFuncs is the only set of functions available to templates, none of them
+// reaches outside of the template data.
+var templateFuncs = template.FuncMap{
+	"lower":      strings.ToLower,
+	"upper":      strings.ToUpper,
+	"trim":       strings.TrimSpace,
+	"trimPrefix": func(prefix, s string) string { return strings.TrimPrefix(s, prefix) },
+	"trimSuffix": func(suffix, s string) string { return strings.TrimSuffix(s, suffix) },
+	"replace":    func(old, new, s string) string { return strings.ReplaceAll(s, old, new) },
+	"contains":   func(substr, s string) bool { return strings.Contains(s, substr) },
+	"hasPrefix":  func(prefix, s string) bool { return strings.HasPrefix(s, prefix) },
+	"hasSuffix":  func(suffix, s string) bool { return strings.HasSuffix(s, suffix) },
+	"split":      func(sep, s string) []string { return strings.Split(s, sep) },
+	"join":       func(sep string, s []string) string { return strings.Join(s, sep) },
+	"default": func(def, s string) string {
+		if s == "" {
+			return def
+		}
+
+		return s
+	},
+}
+
+type templateContainer struct {
+	ID       string
+	Name     string
+	Hostname string
+	Image    string
+}
+
+// templateHost describes the host. Its advertise address is only resolved by the
+// templates using it.
+type templateHost struct {
+	Hostname string
+
+	srv *Service
+}
+
+// Address returns the advertise address of the host.
+func (h templateHost) Address() string {
+	advertised, _ := h.srv.advertiseAddresses()
+	return advertised.Address()
+}
+
+// IPv4 returns the IPv4 advertise address of the host.
+func (h templateHost) IPv4() string {
+	advertised, _ := h.srv.advertiseAddresses()
+	return advertised.IPv4
+}
+
+// IPv6 returns the IPv6 advertise address of the host.
+func (h templateHost) IPv6() string {
+	advertised, _ := h.srv.advertiseAddresses()
+	return advertised.IPv6
+}
+
+// templateData is what names, instance IDs, tags and attributes templates are executed with.
+// Port and Proto are the ones of the instance for instance IDs, and of the first instance
+// otherwise. Name is empty while the name itself is rendered.
+type templateData struct {
+	Container templateContainer
+	Host      templateHost
+	Env       map[string]string
+	Name      string
+	Port      int
+	Proto     string
+
+	labels map[string]string
+}
+
+// Labels returns the value of the container label key, or an empty string.
+func (d templateData) Labels(key string) string {
+	return d.labels[key]
+}
+
+func (s *Service) templateData(port int, proto string) templateData {
+	hostname, _ := os.Hostname()
+	host := templateHost{Hostname: hostname, srv: s}
+
+	env := map[string]string{}
+	for _, value := range s.container.Env {
+		if key, value, ok := strings.Cut(value, "="); ok {
+			env[key] = value
+		}
+	}
+
+	return templateData{
+		Container: templateContainer{
+			ID:       s.container.ID,
+			Name:     strings.TrimLeft(s.container.Name, "/"),
+			Hostname: s.container.Hostname,
+			Image:    s.container.Image,
+		},
+		Host:   host,
+		Env:    env,
+		Name:   s.name,
+		Port:   port,
+		Proto:  proto,
+		labels: s.container.Labels,
+	}
+}
+
+// render executes text as a template, a value without actions is returned as is.
+func render(field, text string, data templateData) (string, error) {
+	if !strings.Contains(text, "{{") {
+		return text, nil
+	}
+
+	tmpl, err := template.New(field).Funcs(templateFuncs).Option("missingkey=zero").Parse(text)
+	if err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrTemplate, field, err)
+	}
+
+	var out bytes.Buffer
+	if err := tmpl.Execute(&out, data); err != nil {
+		return "", fmt.Errorf("%w: %s: %v", ErrTemplate, field, err)
+	}
+
+	return out.String(), nil
+}
+
+// renderConfig renders the value of the label key, or the global default of env when the
+// label is absent. Errors are recorded on the service and reported as missing values.
+func (s *Service) renderConfig(key, env string, data templateData) (string, bool) {
+	text, ok := s.GetConfig(key)
+	if !ok {
+		text, ok = os.LookupEnv(env)
+	}
+
+	if !ok {
+		return "", false
+	}
+
+	rv, err := render(key, text, data)
+	if err != nil {
+		s.errors = append(s.errors, err)
+		return "", false
+	}
+
+	return rv, true
+}
@@ -0,0 +1,101 @@
+package service
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func newTemplateContainer() Container {
+	return Container{
+		ID:       "abc123",
+		Name:     "/web",
+		Hostname: "host",
+		Image:    "nginx:1.25",
+		Env:      []string{"REGION=eu-west-1", "EMPTY="},
+		Labels: map[string]string{
+			"team":                            "payments",
+			"com.github.njasm.clerk.register": "true",
+		},
+		ExposedPorts: []string{"80/tcp", "443/tcp"},
+		Networks:     map[string]Network{"bridge": {IPAddress: "10.0.0.2"}},
+	}
+}
+
+func withLabels(c Container, labels map[string]string) Container {
+	for key, value := range labels {
+		c.Labels[key] = value
+	}
+
+	return c
+}
+
+func TestTemplateName(t *testing.T) {
+	srv := NewFrom(withLabels(newTemplateContainer(), map[string]string{
+		"com.github.njasm.clerk.name": `{{.Container.Name}}-{{.Port}}-{{.Labels "team"}}`,
+	}))
+
+	assert.Empty(t, srv.Errors())
+	assert.Equal(t, "web-80-payments", srv.Name())
+}
+
+func TestTemplateInstanceID(t *testing.T) {
+	srv := NewFrom(withLabels(newTemplateContainer(), map[string]string{
+		"com.github.njasm.clerk.id": `{{.Name}}-{{.Env.REGION}}-{{.Proto}}{{.Port}}`,
+	}))
+
+	assert.Empty(t, srv.Errors())
+	assert.Contains(t, srv.Instances(), "web-eu-west-1-tcp80")
+	assert.Contains(t, srv.Instances(), "web-eu-west-1-tcp443")
+}
+
+func TestTemplateDuplicateInstanceID(t *testing.T) {
+	srv := NewFrom(withLabels(newTemplateContainer(), map[string]string{
+		"com.github.njasm.clerk.id": `{{.Name}}`,
+	}))
+
+	assert.Len(t, srv.Errors(), 1)
+	assert.ErrorIs(t, srv.Errors()[0], ErrTemplate)
+	assert.Len(t, srv.Instances(), 2)
+}
+
+func TestTemplateTagsAndAttributes(t *testing.T) {
+	hostname, _ := os.Hostname()
+	srv := NewFrom(withLabels(newTemplateContainer(), map[string]string{
+		"com.github.njasm.clerk.tags":       `{{.Env.REGION | upper}},{{.Env.EMPTY}},{{.Env.MISSING | default "none"}}`,
+		"com.github.njasm.clerk.attributes": `host:{{.Host.Hostname}},image:{{.Container.Image | replace ":" "@"}}`,
+	}))
+
+	assert.Empty(t, srv.Errors())
+	assert.Equal(t, []string{"EU-WEST-1", "none"}, srv.Tags())
+	assert.Equal(t, map[string]string{"host": hostname, "image": "nginx@1.25"}, srv.Attributes())
+}
+
+func TestTemplateGlobalDefaults(t *testing.T) {
+	t.Setenv(envServiceNameTemplate, `{{.Labels "team"}}-{{.Container.Name}}`)
+	t.Setenv(envServiceTags, `{{.Env.REGION}}`)
+
+	srv := NewFrom(newTemplateContainer())
+	assert.Equal(t, "payments-web", srv.Name())
+	assert.Equal(t, []string{"eu-west-1"}, srv.Tags())
+
+	// labels take precedence over the global defaults
+	srv = NewFrom(withLabels(newTemplateContainer(), map[string]string{"com.github.njasm.clerk.name": "api"}))
+	assert.Equal(t, "api", srv.Name())
+}
+
+func TestTemplateErrors(t *testing.T) {
+	srv := NewFrom(withLabels(newTemplateContainer(), map[string]string{
+		"com.github.njasm.clerk.name": `{{.Container.Nope}}`,
+		"com.github.njasm.clerk.tags": `{{ env "HOME" }}`,
+	}))
+
+	assert.Len(t, srv.Errors(), 2)
+	for _, err := range srv.Errors() {
+		assert.ErrorIs(t, err, ErrTemplate)
+	}
+
+	assert.Equal(t, "web", srv.Name())
+	assert.Empty(t, srv.Tags())
+}
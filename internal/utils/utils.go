@@ -1,5 +1,12 @@
 package utils
 
+import (
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
 type Comparable interface {
 	string | int | float32 | float64
 }
@@ -22,3 +29,54 @@ func Map[T any, R any](list []T, f func(value T) R) []R {
 
 	return rv
 }
+
+// EnvOrDefault returns the value of the environment variable named by key,
+// or def when the variable is unset or empty.
+func EnvOrDefault(key, def string) string {
+	if value := strings.TrimSpace(os.Getenv(key)); value != "" {
+		return value
+	}
+
+	return def
+}
+
+// EnvBool reports whether the environment variable named by key is set to a true value.
+func EnvBool(key string) bool {
+	value, err := strconv.ParseBool(EnvOrDefault(key, "false"))
+	if err != nil {
+		return false
+	}
+
+	return value
+}
+
+// WriteFileAtomic writes data to a temporary file next to filename and renames it over filename,
+// so readers never see a partially written file.
+func WriteFileAtomic(filename string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(filename), "."+filepath.Base(filename)+".*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Chmod(tmp.Name(), perm); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
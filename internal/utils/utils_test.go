@@ -1,6 +1,8 @@
 package utils_test
 
 import (
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/njasm/clerk/internal/utils"
@@ -200,3 +202,43 @@ func TestMap(t *testing.T) {
 	// 	})
 	// }
 }
+
+func TestEnvOrDefault(t *testing.T) {
+	t.Setenv("CLERK_TEST_ENV", "  value ")
+	assert.Equal(t, "value", utils.EnvOrDefault("CLERK_TEST_ENV", "default"))
+
+	t.Setenv("CLERK_TEST_ENV", "")
+	assert.Equal(t, "default", utils.EnvOrDefault("CLERK_TEST_ENV", "default"))
+}
+
+func TestEnvBool(t *testing.T) {
+	scenarios := map[string]bool{
+		"true": true, "1": true, "TRUE": true,
+		"false": false, "0": false, "": false, "invalid": false,
+	}
+
+	for value, expected := range scenarios {
+		t.Run(value, func(t *testing.T) {
+			t.Setenv("CLERK_TEST_ENV", value)
+			assert.Equal(t, expected, utils.EnvBool("CLERK_TEST_ENV"))
+		})
+	}
+}
+
+func TestWriteFileAtomic(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "file.txt")
+	assert.NoError(t, utils.WriteFileAtomic(filename, []byte("first"), 0644))
+	assert.NoError(t, utils.WriteFileAtomic(filename, []byte("second"), 0600))
+
+	data, err := os.ReadFile(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, "second", string(data))
+
+	info, err := os.Stat(filename)
+	assert.NoError(t, err)
+	assert.Equal(t, os.FileMode(0600), info.Mode().Perm())
+
+	entries, err := os.ReadDir(filepath.Dir(filename))
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+}